@@ -0,0 +1,173 @@
+package impala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bippio/go-impala/sasl"
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+)
+
+// Authentication modes
+const (
+	// AuthNoAuth disables authentication. Messages are sent without SASL framing,
+	// as impala daemon without authentication expects
+	AuthNoAuth = "noauth"
+	// AuthNoSASL disables authentication for HiveServer2 with NOSASL authentication
+	AuthNoSASL = "nosasl"
+	// AuthPlain uses SASL PLAIN without password check, as HiveServer2 with
+	// NONE authentication expects. Username is "anonymous" if not set
+	AuthPlain = "plain"
+	// AuthLDAP uses SASL PLAIN with username and password
+	AuthLDAP = "ldap"
+	// AuthKerberos uses SASL GSSAPI
+	AuthKerberos = "kerberos"
+	// AuthDelegationToken uses SASL DIGEST-MD5 with delegation token obtained
+	// by Kerberos authenticated session
+	AuthDelegationToken = "delegation-token"
+	// AuthJWT sends bearer token of TokenProvider. It requires hs2-http protocol
+	AuthJWT = "jwt"
+)
+
+const (
+	// DefaultKerberosService is service name of impala principal
+	DefaultKerberosService = "impala"
+
+	anonymous = "anonymous"
+
+	// HiveServer2 creates DIGEST-MD5 server without protocol for default
+	// server name, so digest-uri is "null/default"
+	digestService = "null"
+	digestHost    = "default"
+)
+
+var authModes = map[string]bool{
+	AuthNoAuth:   true,
+	AuthNoSASL:   true,
+	AuthPlain:    true,
+	AuthLDAP:     true,
+	AuthKerberos: true,
+
+	AuthDelegationToken: true,
+	AuthJWT:             true,
+}
+
+// auth returns authentication mode. UseLDAP is considered if Auth is not set
+func (o *Options) auth() string {
+	if o.Auth != "" {
+		return o.Auth
+	}
+	if o.UseLDAP {
+		return AuthLDAP
+	}
+	return AuthNoAuth
+}
+
+// checkAuth validates authentication mode, so that mistyped mode fails
+// instead of connecting without authentication
+func (o *Options) checkAuth() error {
+	auth := o.auth()
+	if !authModes[auth] {
+		return fmt.Errorf("auth %s not recognized", auth)
+	}
+	if o.CredentialProvider != nil && auth != AuthPlain && auth != AuthLDAP {
+		return fmt.Errorf("credential provider requires auth %s or %s, not %s", AuthPlain, AuthLDAP, auth)
+	}
+	return nil
+}
+
+// usesSASL reports whether authentication mode frames messages with SASL
+func usesSASL(auth string) bool {
+	return auth == AuthPlain || auth == AuthLDAP || auth == AuthKerberos || auth == AuthDelegationToken
+}
+
+// saslOptions returns SASL options of authentication mode
+func saslOptions(ctx context.Context, opts *Options) (*sasl.Options, error) {
+	so := &sasl.Options{
+		Host:     opts.Host,
+		Username: opts.Username,
+		Password: opts.Password,
+		QOP:      opts.SASLQOP,
+
+		MaxFrameSize: opts.MaxFrameSize,
+		BufferSize:   opts.BufferSize,
+	}
+
+	auth := opts.auth()
+	if opts.CredentialProvider != nil && (auth == AuthPlain || auth == AuthLDAP) {
+		username, password, err := opts.CredentialProvider.Credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if username != "" {
+			so.Username = username
+		}
+		so.Password = password
+	}
+
+	switch auth {
+	case AuthPlain:
+		if so.Username == "" {
+			so.Username = anonymous
+		}
+	case AuthLDAP:
+		if so.Username == "" {
+			return nil, errors.New("Please provide username for LDAP auth")
+		}
+
+		if so.Password == "" {
+			return nil, errors.New("Please provide password for LDAP auth")
+		}
+	case AuthKerberos:
+		cl, err := kerberosClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		so.Mechanism = sasl.MechGSSAPI
+		so.KerberosClient = cl
+		so.Service = opts.KerberosService
+		if so.Service == "" {
+			so.Service = DefaultKerberosService
+		}
+	case AuthDelegationToken:
+		if opts.DelegationToken == "" {
+			return nil, errors.New("Please provide delegation token for delegation-token auth")
+		}
+		token, err := sasl.ParseDelegationToken(opts.DelegationToken)
+		if err != nil {
+			return nil, err
+		}
+		so.Mechanism = sasl.MechDigestMD5
+		so.Username, so.Password = token.Credentials()
+		so.Service = digestService
+		so.Host = digestHost
+	default:
+		return nil, fmt.Errorf("auth %s does not use SASL", auth)
+	}
+	return so, nil
+}
+
+// kerberosClient returns client of options or loads credentials cache of kinit
+func kerberosClient(opts *Options) (*krb5.Client, error) {
+	if opts.KerberosClient != nil {
+		return opts.KerberosClient, nil
+	}
+	return sasl.LoadKerberosClient(opts.KerberosCCache)
+}
+
+// negotiationError explains failed SASL negotiation. Server which does not
+// expect SASL closes connection or answers with thrift message
+func negotiationError(auth string, err error) error {
+	var authErr *sasl.AuthError
+	if errors.As(err, &authErr) {
+		return fmt.Errorf("impala: authentication failed (auth=%s): %w", auth, err)
+	}
+	return fmt.Errorf("impala: SASL negotiation failed, server may not expect SASL authentication (auth=%s): %w", auth, err)
+}
+
+// openSessionError explains connection closed by server while opening the
+// first session without SASL, as server which expects SASL does
+func openSessionError(auth string, err error) error {
+	return fmt.Errorf("impala: connection closed while opening session, server may expect SASL authentication (auth=%s): %w", auth, err)
+}
@@ -0,0 +1,181 @@
+package impala
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/beeswax"
+	"github.com/bippio/go-impala/hive"
+)
+
+// BeeswaxConn to impala over legacy Beeswax protocol.
+// It is not used concurrently by multiple goroutines.
+type BeeswaxConn struct {
+	t      thrift.TTransport
+	client *beeswax.Client
+	log    *slog.Logger
+
+	interceptors interceptors
+	retry        *RetryPolicy
+	bad          bool
+}
+
+// Ping impala server
+func (c *BeeswaxConn) Ping(ctx context.Context) error {
+	err := c.client.Ping(ctx)
+	c.check(err)
+	return badConn(err)
+}
+
+// IsValid reports whether connection can be reused
+func (c *BeeswaxConn) IsValid() bool {
+	return !c.bad
+}
+
+// check marks connection broken by transport or protocol error
+func (c *BeeswaxConn) check(err error) {
+	if isBroken(err) {
+		c.log.Debug("connection broken", "error", err)
+		c.bad = true
+	}
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter. CheckNamedValue must do type
+// validation and conversion as appropriate for the driver.
+func (c *BeeswaxConn) CheckNamedValue(val *driver.NamedValue) error {
+	t, ok := val.Value.(time.Time)
+	if ok {
+		val.Value = t.Format(hive.TimestampFormat)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// Prepare returns prepared statement
+func (c *BeeswaxConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext returns prepared statement
+func (c *BeeswaxConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return &Stmt{
+		conn:         c,
+		stmt:         template(query),
+		interceptors: c.interceptors,
+	}, nil
+}
+
+// QueryContext executes a query that may return rows
+func (c *BeeswaxConn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	tmpl := template(q)
+	stmt := statement(tmpl, args)
+	return runQuery(ctx, c, c.interceptors, stmt, args)
+}
+
+// ExecContext executes a query that doesn't return rows
+func (c *BeeswaxConn) ExecContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	tmpl := template(q)
+	stmt := statement(tmpl, args)
+	return runExec(ctx, c, c.interceptors, stmt, args)
+}
+
+// Begin is not supported
+func (c *BeeswaxConn) Begin() (driver.Tx, error) {
+	return nil, ErrNotSupported
+}
+
+// Close connection
+func (c *BeeswaxConn) Close() error {
+	c.log.Debug("close connection")
+	return c.t.Close()
+}
+
+func (c *BeeswaxConn) query(ctx context.Context, stmt string) (driver.Rows, error) {
+	var rows driver.Rows
+	err := retryStatement(ctx, c.retry, stmt, func() error {
+		var err error
+		rows, err = c.queryOnce(ctx, stmt)
+		c.check(err)
+		return err
+	})
+	if r, ok := rows.(*Rows); ok {
+		r.errfn = c.check
+	}
+	return rows, badConn(err)
+}
+
+func (c *BeeswaxConn) queryOnce(ctx context.Context, stmt string) (driver.Rows, error) {
+	if _, ok := impersonation(ctx); ok {
+		return nil, errImpersonationNotSupported
+	}
+	operation, err := c.client.Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := operation.Wait(ctx); err != nil {
+		operation.Close(context.Background())
+		return nil, err
+	}
+
+	schema, err := operation.GetResultSetMetadata(ctx)
+	if err != nil {
+		operation.Close(context.Background())
+		return nil, err
+	}
+
+	rs, err := operation.FetchResults(ctx, schema)
+	if err != nil {
+		operation.Close(context.Background())
+		return nil, err
+	}
+
+	return &Rows{
+		rs:      rs,
+		schema:  schema,
+		closefn: func() error { return operation.Close(ctx) },
+	}, nil
+}
+
+func (c *BeeswaxConn) exec(ctx context.Context, stmt string) (driver.Result, error) {
+	var res driver.Result
+	err := retryStatement(ctx, c.retry, stmt, func() error {
+		var err error
+		res, err = c.execOnce(ctx, stmt)
+		c.check(err)
+		return err
+	})
+	return res, badConn(err)
+}
+
+func (c *BeeswaxConn) execOnce(ctx context.Context, stmt string) (driver.Result, error) {
+	if _, ok := impersonation(ctx); ok {
+		return nil, errImpersonationNotSupported
+	}
+	operation, err := c.client.Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := operation.Wait(ctx); err != nil {
+		operation.Close(context.Background())
+		return nil, err
+	}
+
+	if !beeswax.IsDML(stmt) {
+		if err := operation.Close(ctx); err != nil {
+			return nil, err
+		}
+		return driver.ResultNoRows, nil
+	}
+
+	n, err := operation.CloseInsert(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
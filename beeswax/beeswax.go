@@ -0,0 +1,85 @@
+package beeswax
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bippio/go-impala/services/beeswax"
+	"github.com/bippio/go-impala/services/status"
+)
+
+var (
+	// ErrQueryNotFound means query handle is not known to the server
+	ErrQueryNotFound = errors.New("beeswax: query not found")
+)
+
+func checkError(err error) error {
+	switch e := err.(type) {
+	case *beeswax.BeeswaxException:
+		return errors.New(e.GetMessage())
+	case *beeswax.QueryNotFoundException:
+		return ErrQueryNotFound
+	default:
+		return err
+	}
+}
+
+func checkStatus(s *status.TStatus) error {
+	if s == nil || s.StatusCode == status.TStatusCode_OK {
+		return nil
+	}
+	if len(s.ErrorMsgs) == 0 {
+		return errors.New(s.StatusCode.String())
+	}
+	return errors.New(strings.Join(s.ErrorMsgs, "\n"))
+}
+
+// IsDML returns whether the statement modifies table data, after leading
+// WITH clause if any. Row counts of DML statements are reported by CloseInsert
+func IsDML(stmt string) bool {
+	fields := strings.Fields(strings.TrimLeft(skipWith(stmt), "( \t\r\n"))
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "INSERT", "UPSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// skipWith returns statement after its leading WITH clause, i.e. after the
+// parenthesized subqueries of the clause. Quoted parentheses are ignored
+func skipWith(stmt string) string {
+	s := strings.TrimLeft(stmt, "( \t\r\n")
+	if len(s) < 5 || !strings.EqualFold(s[:4], "WITH") || !strings.ContainsRune(" \t\r\n", rune(s[4])) {
+		return stmt
+	}
+
+	depth := 0
+	var quote byte
+	for i := 4; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				rest := strings.TrimLeft(s[i+1:], " \t\r\n")
+				if !strings.HasPrefix(rest, ",") {
+					return rest
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package beeswax
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/beeswax"
+	"github.com/bippio/go-impala/services/impalaservice"
+)
+
+// Client represents Beeswax Client
+type Client struct {
+	client *impalaservice.ImpalaServiceClient
+	opts   *Options
+	log    *slog.Logger
+}
+
+// Options for Beeswax Client
+type Options struct {
+	MaxRows      int64
+	MemLimit     string
+	QueryTimeout int
+}
+
+// NewClient creates Beeswax Client
+func NewClient(client thrift.TClient, log *slog.Logger, opts *Options) *Client {
+	return &Client{
+		client: impalaservice.NewImpalaServiceClient(client),
+		log:    log,
+		opts:   opts,
+	}
+}
+
+// Ping checks the connection
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.client.PingImpalaService(ctx); err != nil {
+		return checkError(err)
+	}
+	c.log.DebugContext(ctx, "ping")
+	return nil
+}
+
+// Query submits statement for execution and returns operation
+func (c *Client) Query(ctx context.Context, stmt string) (*Operation, error) {
+	var cfg []string
+	if c.opts.MemLimit != "" {
+		cfg = append(cfg, fmt.Sprintf("MEM_LIMIT=%s", c.opts.MemLimit))
+	}
+	if c.opts.QueryTimeout > 0 {
+		cfg = append(cfg, fmt.Sprintf("QUERY_TIMEOUT_S=%d", c.opts.QueryTimeout))
+	}
+
+	q := beeswax.Query{
+		Query:         stmt,
+		Configuration: cfg,
+	}
+
+	h, err := c.client.Query(ctx, &q)
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	c.log.DebugContext(ctx, "execute query", "query", h.GetID())
+	return &Operation{h: h, beeswax: c}, nil
+}
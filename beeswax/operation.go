@@ -0,0 +1,162 @@
+package beeswax
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/logging"
+	"github.com/bippio/go-impala/services/beeswax"
+)
+
+const (
+	pollInterval = 100 * time.Millisecond
+)
+
+// Operation represents beeswax query
+type Operation struct {
+	beeswax *Client
+	h       *beeswax.QueryHandle
+	delim   string
+}
+
+// Wait blocks until query is finished. Query is cancelled if context is done
+func (op *Operation) Wait(ctx context.Context) error {
+	for {
+		state, err := op.beeswax.client.GetState(ctx, op.h)
+		if err != nil {
+			return op.interrupted(ctx, checkError(err))
+		}
+
+		switch state {
+		case beeswax.QueryState_FINISHED:
+			return nil
+		case beeswax.QueryState_EXCEPTION:
+			msg, err := op.beeswax.client.GetLog(ctx, op.h.LogContext)
+			if err != nil {
+				return checkError(err)
+			}
+			return errors.New(msg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return op.interrupted(ctx, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// GetResultSetMetadata return schema
+func (op *Operation) GetResultSetMetadata(ctx context.Context) (*hive.TableSchema, error) {
+	op.beeswax.log.DebugContext(ctx, "fetch metadata", "query", op.h.GetID())
+
+	md, err := op.beeswax.client.GetResultsMetadata(ctx, op.h)
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	schema := new(hive.TableSchema)
+	if md.IsSetSchema() {
+		for _, field := range md.Schema.FieldSchemas {
+			schema.Columns = append(schema.Columns, colDesc(field.GetName(), field.GetType()))
+		}
+	}
+
+	for _, col := range schema.Columns {
+		op.beeswax.log.DebugContext(ctx, "fetch schema", "column", col.Name, "type", col.DatabaseTypeName)
+	}
+
+	op.delim = md.GetDelim()
+	return schema, nil
+}
+
+// FetchResults fetches query result from server
+func (op *Operation) FetchResults(ctx context.Context, schema *hive.TableSchema) (*ResultSet, error) {
+	delim := op.delim
+	if delim == "" {
+		delim = "\t"
+	}
+
+	resp, err := fetch(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResultSet{
+		delim:   delim,
+		rows:    resp.Data,
+		more:    resp.HasMore,
+		schema:  schema,
+		fetchfn: func() (*beeswax.Results, error) { return fetch(ctx, op) },
+	}, nil
+}
+
+func fetch(ctx context.Context, op *Operation) (*beeswax.Results, error) {
+	op.beeswax.log.DebugContext(ctx, "fetch results", "query", op.h.GetID())
+
+	for {
+		resp, err := op.beeswax.client.Fetch(ctx, op.h, false, int32(op.beeswax.opts.MaxRows))
+		if err != nil {
+			return nil, op.interrupted(ctx, checkError(err))
+		}
+		if resp.Ready {
+			op.beeswax.log.Log(ctx, logging.LevelTrace, "results", "results", resp.Data)
+			return resp, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, op.interrupted(ctx, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Cancel cancels running query
+func (op *Operation) Cancel(ctx context.Context) error {
+	op.beeswax.log.DebugContext(ctx, "cancel query", "query", op.h.GetID())
+	s, err := op.beeswax.client.Cancel(ctx, op.h)
+	if err != nil {
+		return checkError(err)
+	}
+	return checkStatus(s)
+}
+
+// CloseInsert closes DML query and returns number of modified rows
+func (op *Operation) CloseInsert(ctx context.Context) (int64, error) {
+	res, err := op.beeswax.client.CloseInsert(ctx, op.h)
+	if err != nil {
+		return 0, checkError(err)
+	}
+
+	var n int64
+	for _, rows := range res.GetRowsAppended() {
+		n += rows
+	}
+
+	op.beeswax.log.DebugContext(ctx, "close insert", "query", op.h.GetID(), "rows_appended", n)
+	return n, nil
+}
+
+// Close closes query
+func (op *Operation) Close(ctx context.Context) error {
+	if err := op.beeswax.client.Close(ctx, op.h); err != nil {
+		return checkError(err)
+	}
+
+	op.beeswax.log.DebugContext(ctx, "close query", "query", op.h.GetID())
+	return nil
+}
+
+// interrupted cancels the query on the server when the context is done
+func (op *Operation) interrupted(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if cerr := op.Cancel(context.Background()); cerr != nil {
+		op.beeswax.log.WarnContext(ctx, "failed to cancel query", "query", op.h.GetID(), "error", cerr)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,132 @@
+package beeswax
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/services/beeswax"
+)
+
+const (
+	// NullValue is text representation of NULL in beeswax results
+	NullValue = "NULL"
+)
+
+var (
+	dataTypeBoolean  = reflect.TypeOf(true)
+	dataTypeFloat64  = reflect.TypeOf(float64(0))
+	dataTypeInt8     = reflect.TypeOf(int8(0))
+	dataTypeInt16    = reflect.TypeOf(int16(0))
+	dataTypeInt32    = reflect.TypeOf(int32(0))
+	dataTypeInt64    = reflect.TypeOf(int64(0))
+	dataTypeString   = reflect.TypeOf("")
+	dataTypeDateTime = reflect.TypeOf(time.Time{})
+)
+
+// ResultSet ...
+type ResultSet struct {
+	idx     int
+	delim   string
+	rows    []string
+	more    bool
+	schema  *hive.TableSchema
+	fetchfn func() (*beeswax.Results, error)
+}
+
+// Next ...
+func (rs *ResultSet) Next(dest []driver.Value) error {
+	// server may return empty batch while more results follow
+	for rs.idx >= len(rs.rows) {
+		if !rs.more {
+			return io.EOF
+		}
+
+		resp, err := rs.fetchfn()
+		if err != nil {
+			return err
+		}
+		rs.rows = resp.Data
+		rs.more = resp.HasMore
+		rs.idx = 0
+	}
+
+	fields := strings.Split(rs.rows[rs.idx], rs.delim)
+	for i := range dest {
+		if i >= len(fields) {
+			return fmt.Errorf("beeswax: row has %d fields, expected %d", len(fields), len(dest))
+		}
+		val, err := value(fields[i], rs.schema.Columns[i])
+		if err != nil {
+			return err
+		}
+		dest[i] = val
+	}
+	rs.idx++
+	return nil
+}
+
+func value(field string, cd *hive.ColDesc) (interface{}, error) {
+	if field == NullValue {
+		return nil, nil
+	}
+
+	switch cd.DatabaseTypeName {
+	case "TINYINT":
+		v, err := strconv.ParseInt(field, 10, 8)
+		return int8(v), err
+	case "SMALLINT":
+		v, err := strconv.ParseInt(field, 10, 16)
+		return int16(v), err
+	case "INT":
+		v, err := strconv.ParseInt(field, 10, 32)
+		return int32(v), err
+	case "BIGINT":
+		return strconv.ParseInt(field, 10, 64)
+	case "BOOLEAN":
+		return strconv.ParseBool(field)
+	case "FLOAT", "DOUBLE", "REAL":
+		return strconv.ParseFloat(field, 64)
+	case "TIMESTAMP":
+		return time.Parse(hive.TimestampFormat, field)
+	default:
+		return field, nil
+	}
+}
+
+// colDesc converts metastore type (e.g. "decimal(10,2)") to column description
+func colDesc(name string, typ string) *hive.ColDesc {
+	base := strings.ToUpper(typ)
+	if i := strings.IndexAny(base, "(<"); i != -1 {
+		base = base[:i]
+	}
+
+	cd := &hive.ColDesc{
+		Name:             name,
+		DatabaseTypeName: base,
+		ScanType:         dataTypeString,
+	}
+
+	switch base {
+	case "BOOLEAN":
+		cd.ScanType = dataTypeBoolean
+	case "TINYINT":
+		cd.ScanType = dataTypeInt8
+	case "SMALLINT":
+		cd.ScanType = dataTypeInt16
+	case "INT":
+		cd.ScanType = dataTypeInt32
+	case "BIGINT":
+		cd.ScanType = dataTypeInt64
+	case "FLOAT", "DOUBLE", "REAL":
+		cd.ScanType = dataTypeFloat64
+	case "TIMESTAMP":
+		cd.ScanType = dataTypeDateTime
+	}
+	return cd
+}
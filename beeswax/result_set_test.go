@@ -0,0 +1,110 @@
+package beeswax
+
+import (
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/services/beeswax"
+)
+
+func TestNext(t *testing.T) {
+	sampletime, _ := time.Parse(time.RFC3339, "2019-01-01T12:00:00Z")
+
+	schema := &hive.TableSchema{
+		Columns: []*hive.ColDesc{
+			colDesc("t", "tinyint"),
+			colDesc("i", "int"),
+			colDesc("b", "bigint"),
+			colDesc("d", "double"),
+			colDesc("s", "varchar(10)"),
+			colDesc("ts", "timestamp"),
+			colDesc("ok", "boolean"),
+		},
+	}
+
+	rs := &ResultSet{
+		delim:  "\t",
+		rows:   []string{"1\t2\t3\t1.5\tstr\t2019-01-01 12:00:00\ttrue"},
+		more:   true,
+		schema: schema,
+		fetchfn: func() (*beeswax.Results, error) {
+			return &beeswax.Results{Ready: true, Data: []string{"NULL\tNULL\tNULL\tNULL\tNULL\tNULL\tNULL"}}, nil
+		},
+	}
+
+	dest := make([]driver.Value, len(schema.Columns))
+	if err := rs.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []driver.Value{int8(1), int32(2), int64(3), float64(1.5), "str", sampletime, true}
+	for i := range want {
+		if dest[i] != want[i] {
+			t.Errorf("column %d. got: %v (%T), want: %v (%T)", i, dest[i], dest[i], want[i], want[i])
+		}
+	}
+
+	if err := rs.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	for i := range dest {
+		if dest[i] != nil {
+			t.Errorf("column %d. got: %v, want: nil", i, dest[i])
+		}
+	}
+
+	if err := rs.Next(dest); err != io.EOF {
+		t.Errorf("got: %v, want: %v", err, io.EOF)
+	}
+}
+
+func TestColDesc(t *testing.T) {
+	tests := []struct {
+		typ      string
+		dbtype   string
+		scanType reflect.Type
+	}{
+		{typ: "int", dbtype: "INT", scanType: reflect.TypeOf(int32(0))},
+		{typ: "timestamp", dbtype: "TIMESTAMP", scanType: reflect.TypeOf(time.Time{})},
+		{typ: "decimal(10,2)", dbtype: "DECIMAL", scanType: reflect.TypeOf("")},
+		{typ: "binary", dbtype: "BINARY", scanType: reflect.TypeOf("")},
+		{typ: "array<int>", dbtype: "ARRAY", scanType: reflect.TypeOf("")},
+		{typ: "map<string,int>", dbtype: "MAP", scanType: reflect.TypeOf("")},
+		{typ: "struct<a:int>", dbtype: "STRUCT", scanType: reflect.TypeOf("")},
+	}
+
+	for _, tt := range tests {
+		cd := colDesc("c", tt.typ)
+		if cd.DatabaseTypeName != tt.dbtype || cd.ScanType != tt.scanType {
+			t.Errorf("colDesc(%q) = %s %v, want: %s %v", tt.typ, cd.DatabaseTypeName, cd.ScanType, tt.dbtype, tt.scanType)
+		}
+	}
+}
+
+func TestIsDML(t *testing.T) {
+	tests := []struct {
+		stmt string
+		dml  bool
+	}{
+		{stmt: "insert into t values (1)", dml: true},
+		{stmt: "  UPSERT INTO t VALUES (1)", dml: true},
+		{stmt: "select 1", dml: false},
+		{stmt: "create table t (i int)", dml: false},
+		{stmt: "", dml: false},
+		{stmt: "WITH t AS (SELECT 1) INSERT INTO s SELECT * FROM t", dml: true},
+		{stmt: "with a as (select ')' x), b as (select (1)) upsert into s select * from a, b", dml: true},
+		{stmt: "WITH t AS (SELECT 1) SELECT * FROM t", dml: false},
+		{stmt: "WITH t AS (INSERT", dml: false},
+		{stmt: "without_with", dml: false},
+	}
+
+	for _, tt := range tests {
+		if IsDML(tt.stmt) != tt.dml {
+			t.Errorf("IsDML(%q) = %v, want: %v", tt.stmt, !tt.dml, tt.dml)
+		}
+	}
+}
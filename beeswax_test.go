@@ -0,0 +1,196 @@
+package impala
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/beeswax"
+	"github.com/bippio/go-impala/services/hive_metastore"
+	"github.com/bippio/go-impala/services/impalaservice"
+)
+
+// fakeBeeswax serves queries with results split into batches, which may be
+// empty. Calls of other methods panic
+type fakeBeeswax struct {
+	impalaservice.ImpalaService
+
+	mu      sync.Mutex
+	batches map[string][][]string
+	fetched map[string]int
+	closed  []string
+}
+
+func (s *fakeBeeswax) PingImpalaService(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeBeeswax) Query(ctx context.Context, q *beeswax.Query) (*beeswax.QueryHandle, error) {
+	return &beeswax.QueryHandle{ID: q.Query}, nil
+}
+
+func (s *fakeBeeswax) GetState(ctx context.Context, h *beeswax.QueryHandle) (beeswax.QueryState, error) {
+	return beeswax.QueryState_FINISHED, nil
+}
+
+func (s *fakeBeeswax) GetResultsMetadata(ctx context.Context, h *beeswax.QueryHandle) (*beeswax.ResultsMetadata, error) {
+	if h.ID == "SELECT broken metadata" {
+		return nil, &beeswax.QueryNotFoundException{}
+	}
+	return &beeswax.ResultsMetadata{
+		Schema: &hive_metastore.Schema{FieldSchemas: []*hive_metastore.FieldSchema{
+			{Name: "i", Type: "int"},
+			{Name: "s", Type: "string"},
+		}},
+		Delim: "\t",
+	}, nil
+}
+
+func (s *fakeBeeswax) Fetch(ctx context.Context, h *beeswax.QueryHandle, startOver bool, size int32) (*beeswax.Results, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h.ID == "SELECT broken fetch" {
+		return nil, &beeswax.BeeswaxException{Message: "fetch failed"}
+	}
+	batches := s.batches[h.ID]
+	i := s.fetched[h.ID]
+	s.fetched[h.ID]++
+	if i >= len(batches) {
+		return &beeswax.Results{Ready: true}, nil
+	}
+	return &beeswax.Results{Ready: true, Data: batches[i], HasMore: i < len(batches)-1}, nil
+}
+
+func (s *fakeBeeswax) Close(ctx context.Context, h *beeswax.QueryHandle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = append(s.closed, h.ID)
+	return nil
+}
+
+// serveBeeswax starts fake beeswax server and returns database connected to it
+func serveBeeswax(t *testing.T, s *fakeBeeswax) *sql.DB {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				transport := thrift.NewTBufferedTransport(thrift.NewTSocketFromConnTimeout(c, 0), 4096)
+				protocol := thrift.NewTBinaryProtocol(transport, true, true)
+				processor := impalaservice.NewImpalaServiceProcessor(s)
+				for {
+					ok, err := processor.Process(context.Background(), protocol, protocol)
+					if err != nil || !ok {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	opts := DefaultOptions
+	opts.Protocol = ProtocolBeeswax
+	opts.Host, opts.Port, _ = net.SplitHostPort(ln.Addr().String())
+	db := sql.OpenDB(NewConnector(&opts))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestBeeswaxQuery(t *testing.T) {
+	srv := &fakeBeeswax{
+		batches: map[string][][]string{
+			"SELECT batches": {
+				{"1\ta"},
+				{},
+				{"2\tb", "3\tNULL"},
+				{},
+			},
+			"SELECT empty": {{}, {}},
+		},
+		fetched: map[string]int{},
+	}
+	db := serveBeeswax(t, srv)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{
+			query: "SELECT batches",
+			want:  [][]interface{}{{int32(1), "a"}, {int32(2), "b"}, {int32(3), nil}},
+		},
+		{query: "SELECT empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rows, err := db.Query(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			var actual [][]interface{}
+			for rows.Next() {
+				var (
+					i sql.NullInt32
+					s sql.NullString
+				)
+				if err := rows.Scan(&i, &s); err != nil {
+					t.Fatal(err)
+				}
+				row := []interface{}{nil, nil}
+				if i.Valid {
+					row[0] = i.Int32
+				}
+				if s.Valid {
+					row[1] = s.String
+				}
+				actual = append(actual, row)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, tt.want) {
+				t.Errorf("rows %v, want %v", actual, tt.want)
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if n := srv.fetched[tt.query]; n != len(srv.batches[tt.query]) {
+				t.Errorf("%d fetches, want one per batch", n)
+			}
+		})
+	}
+}
+
+func TestBeeswaxQueryErrorClosesOperation(t *testing.T) {
+	srv := &fakeBeeswax{fetched: map[string]int{}}
+	db := serveBeeswax(t, srv)
+
+	queries := []string{"SELECT broken metadata", "SELECT broken fetch"}
+	for _, q := range queries {
+		if _, err := db.Query(q); err == nil {
+			t.Errorf("%s: expected error", q)
+		}
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !reflect.DeepEqual(srv.closed, queries) {
+		t.Errorf("closed %v, want %v", srv.closed, queries)
+	}
+}
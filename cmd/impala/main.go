@@ -4,59 +4,143 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"reflect"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	impala "github.com/bippio/go-impala"
+	"github.com/bippio/go-impala/health"
+	"github.com/bippio/go-impala/logging"
+	"github.com/bippio/go-impala/recording"
+	"golang.org/x/term"
 )
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
 
+// run executes command, so that deferred cleanup, e.g. closing of record
+// file, happens before main exits on error
+func run() (err error) {
 	var timeout int
 	var verbose bool
+	var logLevel string
+	var recordPath string
+	var jwtFile string
+	var passwordFile, passwordCmd, passwordEnv string
 	opts := impala.DefaultOptions
 	flag.StringVar(&opts.Host, "host", "", "impalad hostname")
-	flag.StringVar(&opts.Port, "p", "21050", "impala daemon port")
+	flag.StringVar(&opts.Port, "p", "", "impala daemon port; default port of the protocol if not set")
+	flag.StringVar(&opts.Database, "database", "", "default database")
+	flag.StringVar(&opts.Protocol, "protocol", impala.ProtocolHiveServer2, "wire protocol: hs2, hs2-http or beeswax")
 	flag.BoolVar(&opts.UseLDAP, "l", false, "use ldap authentication")
+	flag.StringVar(&opts.Auth, "auth", "", "authentication mode: noauth, nosasl, plain, ldap, kerberos or jwt")
+	flag.StringVar(&opts.KerberosService, "kerberos-service", impala.DefaultKerberosService, "service name of kerberos principal")
+	flag.StringVar(&opts.HTTPPath, "http-path", "", "path of hs2-http endpoint")
+	flag.StringVar(&jwtFile, "jwt-file", "", "file with jwt for jwt authentication")
 	flag.StringVar(&opts.Username, "username", "", "ldap usename")
-	flag.StringVar(&opts.Password, "password", "", "ldap password")
+	flag.StringVar(&opts.Password, "password", "", "ldap password; visible in process list, prefer other password flags or prompt")
+	flag.StringVar(&passwordFile, "password-file", "", "file with ldap password")
+	flag.StringVar(&passwordCmd, "password-cmd", "", "command which prints ldap password, e.g. vault cli")
+	flag.StringVar(&passwordEnv, "password-env", "", "environment variable with ldap password")
 	flag.BoolVar(&opts.UseTLS, "tls", false, "use tls")
-	flag.StringVar(&opts.CACertPath, "ca-cert", "", "ca certificate path")
+	flag.StringVar(&opts.CACertPath, "ca-cert", "", "ca certificate path; system roots are used if not set")
+	flag.StringVar(&opts.ClientCertPath, "client-cert", "", "client certificate path for mutual tls")
+	flag.StringVar(&opts.ClientKeyPath, "client-key", "", "client key path for mutual tls")
+	flag.StringVar(&opts.TLSServerName, "tls-server-name", "", "server name to verify certificate against")
+	flag.StringVar(&opts.TLSMinVersion, "tls-min-version", "", "minimum tls version: 1.0, 1.1, 1.2 or 1.3")
+	flag.BoolVar(&opts.TLSInsecureSkipVerify, "tls-insecure-skip-verify", false, "skip server certificate verification; for development only")
 	flag.IntVar(&opts.BatchSize, "batch-size", 1024, "fetch batch size")
 	flag.StringVar(&opts.MemoryLimit, "mem-limit", "0", "memory limit")
 	flag.IntVar(&opts.QueryTimeout, "query-timeout", 0, "query timeout (in seconds)")
 	flag.IntVar(&timeout, "timeout", 0, "timeout in ms; set 0 to disable timeout")
-	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&verbose, "v", false, "verbose; same as -log-level debug")
+	flag.StringVar(&logLevel, "log-level", "", "log level: trace, debug, info, warn or error")
+	flag.StringVar(&recordPath, "record", "", "record thrift calls to jsonl file for replay in tests")
 	flag.Parse()
 
-	if opts.UseLDAP {
+	if opts.Port == "" {
+		switch opts.Protocol {
+		case impala.ProtocolBeeswax:
+			opts.Port = impala.DefaultBeeswaxPort
+		case impala.ProtocolHiveServer2HTTP:
+			opts.Port = impala.DefaultHTTPPort
+		default:
+			opts.Port = impala.DefaultOptions.Port
+		}
+	}
+
+	switch {
+	case passwordFile != "":
+		opts.CredentialProvider = impala.NewFileCredentialProvider(passwordFile)
+	case strings.TrimSpace(passwordCmd) != "":
+		args := strings.Fields(passwordCmd)
+		opts.CredentialProvider = impala.NewCommandCredentialProvider(args[0], args[1:]...)
+	case passwordEnv != "":
+		opts.CredentialProvider = impala.NewEnvCredentialProvider(passwordEnv)
+	}
+
+	if opts.UseLDAP || opts.Auth == impala.AuthLDAP {
 		if opts.Username == "" {
-			log.Fatalf("Please specify username with --username flag")
+			return errors.New("Please specify username with --username flag")
 		}
-		if opts.Password == "" {
-			log.Fatalf("Please specify password with --password flag")
+		if opts.Password == "" && opts.CredentialProvider == nil {
+			password, err := promptPassword()
+			if err != nil {
+				return err
+			}
+			opts.Password = password
 		}
 	}
 
-	if opts.UseTLS {
-		if opts.CACertPath == "" {
-			log.Fatalf("Please specify ca certificate path with --ca-cert flag")
+	if jwtFile != "" {
+		opts.TokenProvider = impala.NewFileTokenProvider(jwtFile)
+	}
+
+	if verbose && logLevel == "" {
+		logLevel = "debug"
+	}
+
+	if logLevel != "" {
+		level, err := logging.ParseLevel(logLevel)
+		if err != nil {
+			return err
 		}
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 	}
 
-	if verbose {
-		opts.LogOut = os.Stderr
+	if recordPath != "" {
+		f, err := os.Create(recordPath)
+		if err != nil {
+			return err
+		}
+		recorder := recording.NewRecorder(f)
+		defer func() {
+			if rerr := recorder.Err(); rerr != nil && err == nil {
+				err = fmt.Errorf("record: %w", rerr)
+			}
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}()
+		opts.WrapClient = recorder.Client
 	}
 
 	appctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 
@@ -74,17 +158,21 @@ func main() {
 		appctx = ctx
 	}
 
+	if flag.NArg() > 0 && flag.Arg(0) == "health" {
+		return runHealth(appctx, &opts, flag.Args()[1:])
+	}
+
 	var q string
 
 	stdinstat, err := os.Stdin.Stat()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	if stdinstat.Mode()&os.ModeNamedPipe != 0 {
 		bytes, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		q = string(bytes)
 	} else if len(flag.Args()) == 1 {
@@ -94,14 +182,12 @@ func main() {
 		reader := bufio.NewReader(os.Stdin)
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		q = line
 	}
 
-	if err := query(appctx, &opts, q); err != nil {
-		log.Fatal(err)
-	}
+	return query(appctx, &opts, q)
 	//exec(appctx, db, q)
 }
 
@@ -109,11 +195,11 @@ func query(ctx context.Context, opts *impala.Options, query string) error {
 	connector := impala.NewConnector(opts)
 
 	db := sql.OpenDB(connector)
-	
-	defer func () {
+
+	defer func() {
 		db.Close()
 	}()
-	
+
 	if err := db.PingContext(ctx); err != nil {
 		return err
 	}
@@ -141,8 +227,8 @@ func query(ctx context.Context, opts *impala.Options, query string) error {
 	for rows.Next() {
 		errv := scanner.Call(in)
 		if !errv[0].IsNil() {
-			errtext := errv[0].MethodByName("Error").Call(nil)[0].String()
-			log.Fatal(errtext)
+			rows.Close()
+			return errv[0].Interface().(error)
 		}
 
 		once.Do(func() {
@@ -165,6 +251,68 @@ func query(ctx context.Context, opts *impala.Options, query string) error {
 	return nil
 }
 
+// runHealth runs health subcommand with its arguments
+func runHealth(ctx context.Context, opts *impala.Options, args []string) error {
+	var jsonOut bool
+	var fb303Addr string
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	fs.BoolVar(&jsonOut, "json", false, "print report as json")
+	fs.StringVar(&fb303Addr, "fb303", "", "query fb303 service at host:port instead of impala daemon")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("health: unexpected arguments %q", fs.Args())
+	}
+
+	var report *health.Report
+	if fb303Addr != "" {
+		client, transport, err := impala.DialFB303(ctx, opts, fb303Addr)
+		if err != nil {
+			return err
+		}
+		defer transport.Close()
+
+		report, err = health.NewFB303(client).Check(ctx)
+		if err != nil {
+			return err
+		}
+	} else {
+		db := sql.OpenDB(impala.NewConnector(opts))
+		defer db.Close()
+
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		err = conn.Raw(func(dc interface{}) error {
+			c, ok := dc.(*impala.Conn)
+			if !ok {
+				return fmt.Errorf("health is not supported over %s protocol", opts.Protocol)
+			}
+			session, err := c.OpenSession(ctx)
+			if err != nil {
+				return err
+			}
+			report, err = health.NewHiveServer2(session).Check(ctx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if jsonOut {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	return report.WriteText(os.Stdout)
+}
+
 func exec(ctx context.Context, db *sql.DB, query string) error {
 	res, err := db.ExecContext(ctx, query)
 	if err != nil {
@@ -175,3 +323,19 @@ func exec(ctx context.Context, db *sql.DB, query string) error {
 	fmt.Print("The operation has no results.\n")
 	return nil
 }
+
+// promptPassword reads password from terminal without echo
+func promptPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("Please specify password with --password-file, --password-cmd or --password-env flag")
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
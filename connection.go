@@ -3,19 +3,39 @@ package impala
 import (
 	"context"
 	"database/sql/driver"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/bippio/go-impala/hive"
 )
 
+// conn is implemented by connections of every supported protocol
+type conn interface {
+	driver.Conn
+	query(ctx context.Context, stmt string) (driver.Rows, error)
+	exec(ctx context.Context, stmt string) (driver.Result, error)
+}
+
 // Conn to impala. It is not used concurrently by multiple goroutines.
 type Conn struct {
-	t       thrift.TTransport
-	session *hive.Session
-	client  *hive.Client
-	log     *log.Logger
+	t      thrift.TTransport
+	client *hive.Client
+	log    *slog.Logger
+
+	// sessions by impersonated user. Key of session without impersonation is empty
+	sessions    map[string]*hive.Session
+	impersonate string
+	// database is default database of every session
+	database string
+
+	interceptors interceptors
+	retry        *RetryPolicy
+	bad          bool
+
+	// auth mode and whether session was ever opened, to explain failure of the first one
+	auth   string
+	opened bool
 }
 
 // Ping impala server
@@ -26,7 +46,8 @@ func (c *Conn) Ping(ctx context.Context) error {
 	}
 
 	if err := session.Ping(ctx); err != nil {
-		return err
+		c.check(err)
+		return badConn(err)
 	}
 
 	return nil
@@ -52,33 +73,73 @@ func (c *Conn) Prepare(query string) (driver.Stmt, error) {
 // PrepareContext returns prepared statement
 func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
 	return &Stmt{
-		conn: c,
-		stmt: template(query),
+		conn:         c,
+		stmt:         template(query),
+		interceptors: c.interceptors,
 	}, nil
 }
 
 // QueryContext executes a query that may return rows
 func (c *Conn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
-	session, err := c.OpenSession(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	tmpl := template(q)
 	stmt := statement(tmpl, args)
-	return query(ctx, session, stmt)
+	return runQuery(ctx, c, c.interceptors, stmt, args)
 }
 
 // ExecContext executes a query that doesn't return rows
 func (c *Conn) ExecContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
-	session, err := c.OpenSession(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	tmpl := template(q)
 	stmt := statement(tmpl, args)
-	return exec(ctx, session, stmt)
+	return runExec(ctx, c, c.interceptors, stmt, args)
+}
+
+func (c *Conn) query(ctx context.Context, stmt string) (driver.Rows, error) {
+	var rows driver.Rows
+	err := retryStatement(ctx, c.retry, stmt, func() error {
+		session, err := c.OpenSession(ctx)
+		if err != nil {
+			return err
+		}
+		rows, err = query(ctx, session, stmt)
+		c.check(err)
+		return err
+	})
+	if r, ok := rows.(*Rows); ok {
+		r.errfn = c.check
+	}
+	return rows, badConn(err)
+}
+
+func (c *Conn) exec(ctx context.Context, stmt string) (driver.Result, error) {
+	var res driver.Result
+	err := retryStatement(ctx, c.retry, stmt, func() error {
+		session, err := c.OpenSession(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = exec(ctx, session, stmt)
+		c.check(err)
+		return err
+	})
+	return res, badConn(err)
+}
+
+// check marks connection broken by transport or protocol error, and drops
+// session which is no longer known to the server, so that next statement opens a new one
+func (c *Conn) check(err error) {
+	if isBroken(err) {
+		c.log.Debug("connection broken", "error", err)
+		c.bad = true
+	}
+	if isInvalidHandle(err) {
+		c.log.Debug("session lost", "error", err)
+		c.sessions = nil
+	}
+}
+
+// IsValid reports whether connection can be reused
+func (c *Conn) IsValid() bool {
+	return !c.bad
 }
 
 // Begin is not supported
@@ -86,32 +147,71 @@ func (c *Conn) Begin() (driver.Tx, error) {
 	return nil, ErrNotSupported
 }
 
-// OpenSession ensure opened session
+// OpenSession ensure opened session of user impersonated in context or options
 func (c *Conn) OpenSession(ctx context.Context) (*hive.Session, error) {
-	if c.session == nil {
-		session, err := c.client.OpenSession(ctx)
+	user, ok := impersonation(ctx)
+	if !ok {
+		user = c.impersonate
+	}
+
+	session := c.sessions[user]
+	if session == nil {
+		var err error
+		session, err = c.client.OpenSessionWithConfig(ctx, sessionConfig(user, c.database))
 		if err != nil {
-			c.log.Printf("failed to open session: %v", err)
+			c.log.ErrorContext(ctx, "failed to open session", "error", err)
+			if isUnauthorized(err) {
+				c.bad = true
+				return nil, err
+			}
+			if !c.opened && !usesSASL(c.auth) && isConnectionError(err) {
+				c.bad = true
+				return nil, openSessionError(c.auth, err)
+			}
 			return nil, driver.ErrBadConn
 		}
-		c.session = session
+		if c.sessions == nil {
+			c.sessions = make(map[string]*hive.Session)
+		}
+		c.sessions[user] = session
+		c.opened = true
+	}
+	return session, nil
+}
+
+// sessionConfig returns configuration of session impersonating user, with
+// default database
+func sessionConfig(user, database string) map[string]string {
+	conf := make(map[string]string)
+	if user != "" {
+		conf[hive.ConfImpersonateUser] = user
+	}
+	if database != "" {
+		conf[hive.ConfUseDatabase] = database
 	}
-	return c.session, nil
+	if len(conf) == 0 {
+		return nil
+	}
+	return conf
 }
 
-// ResetSession closes hive session
+// ResetSession closes hive sessions, so that connection does not keep
+// sessions of impersonated users in the pool
 func (c *Conn) ResetSession(ctx context.Context) error {
-	if c.session != nil {
-		if err := c.session.Close(ctx); err != nil {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	for user, session := range c.sessions {
+		if err := session.Close(ctx); err != nil {
 			return err
 		}
-		c.session = nil
+		delete(c.sessions, user)
 	}
 	return nil
 }
 
 // Close connection
 func (c *Conn) Close() error {
-	c.log.Printf("close connection")
+	c.log.Debug("close connection")
 	return c.t.Close()
 }
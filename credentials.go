@@ -0,0 +1,95 @@
+package impala
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"strings"
+)
+
+// CredentialProvider supplies username and password of plain and ldap auth,
+// so that password needs not be in DSN. Credentials is called on every
+// connect. Options.Username is used if returned username is empty
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (username, password string, err error)
+}
+
+// EnvCredentialProvider reads credentials from environment variables
+type EnvCredentialProvider struct {
+	// UsernameVar is optional name of variable with username
+	UsernameVar string
+	PasswordVar string
+}
+
+// NewEnvCredentialProvider creates provider of password in variable
+func NewEnvCredentialProvider(passwordVar string) *EnvCredentialProvider {
+	return &EnvCredentialProvider{PasswordVar: passwordVar}
+}
+
+// Credentials returns values of variables
+func (p *EnvCredentialProvider) Credentials(ctx context.Context) (string, string, error) {
+	password, ok := os.LookupEnv(p.PasswordVar)
+	if !ok {
+		return "", "", fmt.Errorf("impala: password variable %s is not set", p.PasswordVar)
+	}
+	var username string
+	if p.UsernameVar != "" {
+		username = os.Getenv(p.UsernameVar)
+	}
+	return username, password, nil
+}
+
+// FileCredentialProvider reads password from file, e.g. secret mounted by
+// Kubernetes. Trailing newline is removed
+type FileCredentialProvider struct {
+	Path string
+}
+
+// NewFileCredentialProvider creates provider of password in file at path
+func NewFileCredentialProvider(path string) *FileCredentialProvider {
+	return &FileCredentialProvider{Path: path}
+}
+
+// Credentials returns content of the file as password
+func (p *FileCredentialProvider) Credentials(ctx context.Context) (string, string, error) {
+	b, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", "", fmt.Errorf("impala: failed to read password: %w", err)
+	}
+	return "", strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// CommandCredentialProvider runs command, such as vault CLI, which prints
+// password to stdout. Trailing newline is removed
+type CommandCredentialProvider struct {
+	Name string
+	Args []string
+}
+
+// NewCommandCredentialProvider creates provider of password printed by command
+func NewCommandCredentialProvider(name string, args ...string) *CommandCredentialProvider {
+	return &CommandCredentialProvider{Name: name, Args: args}
+}
+
+// Credentials runs the command and returns its output as password
+func (p *CommandCredentialProvider) Credentials(ctx context.Context) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := osexec.CommandContext(ctx, p.Name, p.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", "", fmt.Errorf("impala: password command %s failed: %w: %s", p.Name, err, msg)
+		}
+		return "", "", fmt.Errorf("impala: password command %s failed: %w", p.Name, err)
+	}
+
+	password := strings.TrimRight(stdout.String(), "\r\n")
+	if password == "" {
+		return "", "", errors.New("impala: password command printed empty password")
+	}
+	return "", password, nil
+}
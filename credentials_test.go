@@ -0,0 +1,53 @@
+package impala
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IMPALA_TEST_USER", "bob")
+	t.Setenv("IMPALA_TEST_PASSWORD", "from env")
+
+	tests := []struct {
+		name     string
+		provider CredentialProvider
+		username string
+		password string
+		err      string
+	}{
+		{"env", NewEnvCredentialProvider("IMPALA_TEST_PASSWORD"), "", "from env", ""},
+		{"env username", &EnvCredentialProvider{UsernameVar: "IMPALA_TEST_USER", PasswordVar: "IMPALA_TEST_PASSWORD"}, "bob", "from env", ""},
+		{"env missing", NewEnvCredentialProvider("IMPALA_TEST_MISSING"), "", "", "IMPALA_TEST_MISSING is not set"},
+		{"file", NewFileCredentialProvider(path), "", "from file", ""},
+		{"file missing", NewFileCredentialProvider(path + ".missing"), "", "", "failed to read password"},
+		{"command", NewCommandCredentialProvider("echo", "from command"), "", "from command", ""},
+		{"command failure", NewCommandCredentialProvider("sh", "-c", "echo denied >&2; exit 1"), "", "", "exit status 1: denied"},
+		{"command empty", NewCommandCredentialProvider("true"), "", "", "empty password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, err := tt.provider.Credentials(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != tt.username || password != tt.password {
+				t.Errorf("got %q %q, want %q %q", username, password, tt.username, tt.password)
+			}
+		})
+	}
+}
@@ -3,20 +3,23 @@ package impala
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"database/sql/driver"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/beeswax"
 	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/logging"
+	"github.com/bippio/go-impala/metrics"
 	"github.com/bippio/go-impala/sasl"
+	"github.com/bippio/go-impala/tlsconfig"
 )
 
 var (
@@ -34,9 +37,7 @@ func (d *Driver) Open(uri string) (driver.Conn, error) {
 		return nil, err
 	}
 
-	log.Printf("opts: %v", opts)
-
-	conn, err := connect(opts)
+	conn, err := connect(context.Background(), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -63,8 +64,27 @@ func parseURI(uri string) (*Options, error) {
 		}
 	}
 
+	query := u.Query()
+
+	protocol, ok := query["protocol"]
+	if ok {
+		switch protocol[0] {
+		case ProtocolHiveServer2, ProtocolHiveServer2HTTP, ProtocolBeeswax:
+			opts.Protocol = protocol[0]
+		default:
+			return nil, fmt.Errorf("protocol %s not recognized", protocol[0])
+		}
+	}
+
 	if !strings.Contains(u.Host, ":") {
-		u.Host = fmt.Sprintf("%s:%s", u.Host, DefaultOptions.Port)
+		port := DefaultOptions.Port
+		switch opts.Protocol {
+		case ProtocolBeeswax:
+			port = DefaultBeeswaxPort
+		case ProtocolHiveServer2HTTP:
+			port = DefaultHTTPPort
+		}
+		u.Host = fmt.Sprintf("%s:%s", u.Host, port)
 	}
 
 	host, port, err := net.SplitHostPort(u.Host)
@@ -75,10 +95,87 @@ func parseURI(uri string) (*Options, error) {
 	opts.Host = host
 	opts.Port = port
 
-	query := u.Query()
-	auth := query.Get("auth")
-	if auth == "ldap" {
-		opts.UseLDAP = true
+	if database := strings.Trim(u.Path, "/"); database != "" {
+		if !validDatabase(database) {
+			return nil, fmt.Errorf("invalid database %q", database)
+		}
+		opts.Database = database
+	}
+
+	auth, ok := query["auth"]
+	if ok {
+		if !authModes[auth[0]] {
+			return nil, fmt.Errorf("auth %s not recognized", auth[0])
+		}
+		opts.Auth = auth[0]
+		opts.UseLDAP = auth[0] == AuthLDAP
+	}
+
+	kerberosService, ok := query["kerberos-service"]
+	if ok {
+		opts.KerberosService = kerberosService[0]
+	}
+
+	kerberosCCache, ok := query["kerberos-ccache"]
+	if ok {
+		opts.KerberosCCache = kerberosCCache[0]
+	}
+
+	delegationToken, ok := query["delegation-token"]
+	if ok {
+		opts.DelegationToken = delegationToken[0]
+	}
+
+	passwordEnv, ok := query["password-env"]
+	if ok {
+		opts.CredentialProvider = NewEnvCredentialProvider(passwordEnv[0])
+	}
+
+	usernameEnv, ok := query["username-env"]
+	if ok {
+		p, isEnv := opts.CredentialProvider.(*EnvCredentialProvider)
+		if !isEnv {
+			return nil, errors.New("username-env requires password-env")
+		}
+		p.UsernameVar = usernameEnv[0]
+	}
+
+	// DSN may come from untrusted source, so it must not read files or run commands
+	for _, name := range []string{"password-file", "password-cmd"} {
+		if _, ok := query[name]; ok {
+			return nil, fmt.Errorf("%s is not accepted in DSN, set Options.CredentialProvider", name)
+		}
+	}
+
+	jwt, ok := query["jwt"]
+	if ok {
+		opts.TokenProvider = StaticToken(jwt[0])
+	}
+
+	jwtFile, ok := query["jwt-file"]
+	if ok {
+		opts.TokenProvider = NewFileTokenProvider(jwtFile[0])
+	}
+
+	impersonate, ok := query["impersonate"]
+	if ok {
+		opts.ImpersonateUser = impersonate[0]
+	}
+
+	httpPath, ok := query["http-path"]
+	if ok {
+		opts.HTTPPath = strings.TrimPrefix(httpPath[0], "/")
+	}
+
+	qop, ok := query["sasl-qop"]
+	if ok {
+		for _, s := range strings.Split(qop[0], ",") {
+			q, err := sasl.ParseQOP(s)
+			if err != nil {
+				return nil, err
+			}
+			opts.SASLQOP = append(opts.SASLQOP, q)
+		}
 	}
 
 	tls, ok := query["tls"]
@@ -95,6 +192,38 @@ func parseURI(uri string) (*Options, error) {
 		opts.CACertPath = caCert[0]
 	}
 
+	clientCert, ok := query["client-cert"]
+	if ok {
+		opts.ClientCertPath = clientCert[0]
+	}
+
+	clientKey, ok := query["client-key"]
+	if ok {
+		opts.ClientKeyPath = clientKey[0]
+	}
+
+	serverName, ok := query["tls-server-name"]
+	if ok {
+		opts.TLSServerName = serverName[0]
+	}
+
+	minVersion, ok := query["tls-min-version"]
+	if ok {
+		if _, ok := tlsconfig.Versions[minVersion[0]]; !ok {
+			return nil, fmt.Errorf("tls version %s not recognized", minVersion[0])
+		}
+		opts.TLSMinVersion = minVersion[0]
+	}
+
+	skipVerify, ok := query["tls-insecure-skip-verify"]
+	if ok {
+		v, err := strconv.ParseBool(skipVerify[0])
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSInsecureSkipVerify = v
+	}
+
 	batchSize, ok := query["batch-size"]
 	if ok {
 		size, err := strconv.Atoi(batchSize[0])
@@ -113,6 +242,15 @@ func parseURI(uri string) (*Options, error) {
 		opts.BufferSize = size
 	}
 
+	maxFrameSize, ok := query["max-frame-size"]
+	if ok {
+		size, err := strconv.Atoi(maxFrameSize[0])
+		if err != nil {
+			return nil, err
+		}
+		opts.MaxFrameSize = size
+	}
+
 	memLimit, ok := query["mem-limit"]
 	if ok {
 		opts.MemoryLimit = memLimit[0]
@@ -127,9 +265,131 @@ func parseURI(uri string) (*Options, error) {
 		opts.QueryTimeout = qTimeout
 	}
 
+	connectTimeout, ok := query["connect-timeout"]
+	if ok {
+		d, err := time.ParseDuration(connectTimeout[0])
+		if err != nil {
+			return nil, err
+		}
+		opts.ConnectTimeout = d
+	}
+
+	socketTimeout, ok := query["socket-timeout"]
+	if ok {
+		d, err := time.ParseDuration(socketTimeout[0])
+		if err != nil {
+			return nil, err
+		}
+		opts.SocketTimeout = d
+	}
+
+	keepAlive, ok := query["keepalive"]
+	if ok {
+		if v, err := strconv.ParseBool(keepAlive[0]); err == nil {
+			if !v {
+				opts.KeepAlive = -1
+			}
+		} else {
+			d, err := time.ParseDuration(keepAlive[0])
+			if err != nil {
+				return nil, err
+			}
+			opts.KeepAlive = d
+		}
+	}
+
+	proxy, ok := query["proxy"]
+	if ok {
+		opts.Proxy = proxy[0]
+		u, err := proxyURL(&opts)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			if _, err := NewProxyDialer(u, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	proxyFromEnv, ok := query["proxy-from-env"]
+	if ok {
+		v, err := strconv.ParseBool(proxyFromEnv[0])
+		if err != nil {
+			return nil, err
+		}
+		opts.ProxyFromEnvironment = v
+	}
+
+	maxAttempts, ok := query["retry-max-attempts"]
+	if ok {
+		n, err := strconv.Atoi(maxAttempts[0])
+		if err != nil {
+			return nil, err
+		}
+		retry := DefaultRetryPolicy
+		retry.MaxAttempts = n
+		opts.Retry = &retry
+	}
+
+	// other parameters of retry policy enable it with defaults
+	retry := func() *RetryPolicy {
+		if opts.Retry == nil {
+			policy := DefaultRetryPolicy
+			opts.Retry = &policy
+		}
+		return opts.Retry
+	}
+
+	initialBackoff, ok := query["retry-initial-backoff"]
+	if ok {
+		d, err := time.ParseDuration(initialBackoff[0])
+		if err != nil {
+			return nil, err
+		}
+		retry().InitialBackoff = d
+	}
+
+	maxBackoff, ok := query["retry-max-backoff"]
+	if ok {
+		d, err := time.ParseDuration(maxBackoff[0])
+		if err != nil {
+			return nil, err
+		}
+		retry().MaxBackoff = d
+	}
+
+	multiplier, ok := query["retry-multiplier"]
+	if ok {
+		v, err := strconv.ParseFloat(multiplier[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		retry().Multiplier = v
+	}
+
+	jitter, ok := query["retry-jitter"]
+	if ok {
+		v, err := strconv.ParseFloat(jitter[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		retry().Jitter = v
+	}
+
 	return &opts, nil
 }
 
+// validDatabase reports whether name is identifier of database
+func validDatabase(name string) bool {
+	for _, r := range name {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return name != ""
+}
+
 // OpenConnector parses name and return connector with fixed options
 func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
 
@@ -152,82 +412,179 @@ func NewConnector(opts *Options) driver.Connector {
 }
 
 func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
-	return connect(c.opts)
+	return connect(ctx, c.opts)
 }
 
 func (c *connector) Driver() driver.Driver {
 	return c.d
 }
 
-func connect(opts *Options) (*Conn, error) {
-
-	addr := net.JoinHostPort(opts.Host, opts.Port)
-
-	var socket thrift.TTransport
-	var err error
-	if opts.UseTLS {
+func connect(ctx context.Context, opts *Options) (driver.Conn, error) {
+	transport, tclient, logger, err := openClient(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		if opts.CACertPath == "" {
-			return nil, errors.New("Please provide CA certificate path")
+	switch opts.Protocol {
+	case ProtocolBeeswax:
+		if opts.ImpersonateUser != "" {
+			transport.Close()
+			return nil, errImpersonationNotSupported
 		}
-
-		caCert, err := ioutil.ReadFile(opts.CACertPath)
-		if err != nil {
-			return nil, err
+		client := beeswax.NewClient(tclient, logger, &beeswax.Options{
+			MaxRows:      int64(opts.BatchSize),
+			MemLimit:     opts.MemoryLimit,
+			QueryTimeout: opts.QueryTimeout,
+		})
+		conn := &BeeswaxConn{client: client, t: transport, log: logger, interceptors: opts.Interceptors, retry: opts.Retry}
+		// beeswax has no session configuration, but keeps database of connection
+		if opts.Database != "" {
+			if !validDatabase(opts.Database) {
+				transport.Close()
+				return nil, fmt.Errorf("invalid database %q", opts.Database)
+			}
+			if _, err := conn.execOnce(ctx, "USE "+opts.Database); err != nil {
+				transport.Close()
+				return nil, err
+			}
 		}
+		return conn, nil
+	default:
+		client := newHiveClient(tclient, logger, opts)
+		return &Conn{client: client, t: transport, log: logger, interceptors: opts.Interceptors, retry: opts.Retry, auth: opts.auth(), impersonate: opts.ImpersonateUser, database: opts.Database}, nil
+	}
+}
 
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-
-		socket, err = thrift.NewTSSLSocket(addr, &tls.Config{
-			RootCAs: caCertPool,
-		})
-	} else {
-		socket, err = thrift.NewTSocket(addr)
+// openClient dials with retries and creates thrift client of the connection
+func openClient(ctx context.Context, opts *Options) (thrift.TTransport, thrift.TClient, *slog.Logger, error) {
+	if err := opts.checkAuth(); err != nil {
+		return nil, nil, nil, err
 	}
 
+	var transport thrift.TTransport
+	err := opts.Retry.do(ctx, func() error {
+		var err error
+		transport, err = dial(ctx, opts)
+		return err
+	}, isConnectionError)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	var transport thrift.TTransport
-	if opts.UseLDAP {
+	logger := logging.New(opts.Logger)
+	logger.Debug("connect", "opts", opts)
 
-		if opts.Username == "" {
-			return nil, errors.New("Please provide username for LDAP auth")
-		}
+	protocol := thrift.NewTBinaryProtocol(transport, false, true)
+	var tclient thrift.TClient = thrift.NewTStandardClient(protocol, protocol)
+	if opts.WrapClient != nil {
+		tclient = opts.WrapClient(tclient)
+	}
+	return transport, tclient, logger, nil
+}
 
-		if opts.Password == "" {
-			return nil, errors.New("Please provide password for LDAP auth")
-		}
+func newHiveClient(tclient thrift.TClient, logger *slog.Logger, opts *Options) *hive.Client {
+	return hive.NewClient(tclient, logger, &hive.Options{
+		MaxRows:        int64(opts.BatchSize),
+		MemLimit:       opts.MemoryLimit,
+		QueryTimeout:   opts.QueryTimeout,
+		TracerProvider: opts.TracerProvider,
+		Metrics:        opts.Metrics,
+	})
+}
 
-		transport, err = sasl.NewTSaslTransport(socket, &sasl.Options{
-			Host:     opts.Host,
-			Username: opts.Username,
-			Password: opts.Password,
-		})
+// dial opens transport to impala daemon. Context and ConnectTimeout bound
+// dialing, TLS handshake and SASL negotiation
+func dial(ctx context.Context, opts *Options) (thrift.TTransport, error) {
+	if opts.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ConnectTimeout)
+		defer cancel()
+	}
+
+	if opts.Protocol == ProtocolHiveServer2HTTP {
+		return dialHTTP(ctx, opts)
+	}
+	auth := opts.auth()
+	if auth == AuthJWT {
+		return nil, fmt.Errorf("auth %s requires protocol %s", AuthJWT, ProtocolHiveServer2HTTP)
+	}
 
+	var saslOpts *sasl.Options
+	if usesSASL(auth) {
+		var err error
+		saslOpts, err = saslOptions(ctx, opts)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		transport = thrift.NewTBufferedTransport(socket, opts.BufferSize)
 	}
 
-	protocol := thrift.NewTBinaryProtocol(transport, false, true)
+	conn, err := dialConn(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var socket thrift.TTransport = thrift.NewTSocketFromConnTimeout(conn, opts.SocketTimeout)
+
+	if opts.WrapTransport != nil {
+		socket = opts.WrapTransport(socket)
+	}
 
-	if err := transport.Open(); err != nil {
+	if opts.Metrics != nil {
+		socket = metrics.NewTransport(socket, opts.Metrics)
+	}
+
+	if saslOpts == nil {
+		return thrift.NewTBufferedTransport(socket, opts.BufferSize), nil
+	}
+
+	transport, err := sasl.NewTSaslTransport(socket, saslOpts)
+	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	logger := log.New(opts.LogOut, "impala: ", log.LstdFlags)
+	// closing connection interrupts negotiation when context is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	err = transport.Open()
+	if !stop() {
+		return nil, fmt.Errorf("impala: SASL negotiation interrupted: %w", ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		return nil, negotiationError(auth, err)
+	}
 
-	tclient := thrift.NewTStandardClient(protocol, protocol)
-	client := hive.NewClient(tclient, logger, &hive.Options{
-		MaxRows:  int64(opts.BatchSize),
-		MemLimit: opts.MemoryLimit,
-		QueryTimeout: opts.QueryTimeout,
-	})
+	return transport, nil
+}
 
-	return &Conn{client: client, t: transport, log: logger}, nil
+// dialConn connects to impala daemon, possibly through proxy, and completes
+// TLS handshake
+func dialConn(ctx context.Context, opts *Options) (net.Conn, error) {
+	dialer, err := newDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(opts.Host, opts.Port))
+	if err != nil {
+		return nil, err
+	}
+	if !opts.UseTLS {
+		return conn, nil
+	}
+
+	cfg, err := tlsConfig(opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = opts.Host
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
 }
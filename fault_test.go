@@ -0,0 +1,185 @@
+package impala
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/impalatest"
+)
+
+type tapTransport struct {
+	thrift.TTransport
+	buf *bytes.Buffer
+}
+
+func (t *tapTransport) Read(buf []byte) (int, error) {
+	n, err := t.TTransport.Read(buf)
+	t.buf.Write(buf[:n])
+	return n, err
+}
+
+func faultServer(t *testing.T) *impalatest.Server {
+	srv := newServer(t, impalatest.Options{Username: "admin", Password: "secret"})
+	srv.Handle("SELECT * FROM t", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "i", Type: "INT"}, {Name: "s", Type: "STRING"}},
+		Rows:    [][]interface{}{{1, "a"}, {2, nil}, {3, "c"}},
+	})
+	return srv
+}
+
+func faultDB(t *testing.T, srv *impalatest.Server, wrap func(thrift.TTransport) thrift.TTransport) *sql.DB {
+	return openServer(t, srv, func(opts *Options) {
+		opts.UseLDAP = true
+		opts.Username = "admin"
+		opts.Password = "secret"
+		opts.BatchSize = 2
+		opts.WrapTransport = wrap
+	})
+}
+
+// queryAll runs query and fails test if it does not finish in time
+func queryAll(t *testing.T, db *sql.DB) error {
+	done := make(chan error, 1)
+	go func() {
+		rows, err := db.Query("SELECT * FROM t")
+		if err != nil {
+			done <- err
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var i int32
+			var s sql.NullString
+			if err := rows.Scan(&i, &s); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- rows.Err()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("query hangs")
+		return nil
+	}
+}
+
+// faultOnce injects faults into the first connection only
+func faultOnce(f impalatest.Faults) func(thrift.TTransport) thrift.TTransport {
+	used := false
+	return func(t thrift.TTransport) thrift.TTransport {
+		if used {
+			return t
+		}
+		used = true
+		return f.Wrap(t)
+	}
+}
+
+// cleanSession returns bytes read by clean session
+func cleanSession(t *testing.T, srv *impalatest.Server) []byte {
+	var buf bytes.Buffer
+	db := faultDB(t, srv, func(tr thrift.TTransport) thrift.TTransport {
+		return &tapTransport{TTransport: tr, buf: &buf}
+	})
+	if err := queryAll(t, db); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	return buf.Bytes()
+}
+
+func TestFaultLatency(t *testing.T) {
+	srv := faultServer(t)
+	db := faultDB(t, srv, impalatest.Faults{Latency: 5 * time.Millisecond}.Wrap)
+
+	start := time.Now()
+	if err := queryAll(t, db); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("query finished in %v, expected latency", d)
+	}
+}
+
+func TestFaultReset(t *testing.T) {
+	srv := faultServer(t)
+	total := int64(len(cleanSession(t, srv)))
+
+	// resets during SASL negotiation fail connecting. Resets while opening
+	// session are reported as driver.ErrBadConn and retried by database/sql
+	// on a new connection
+	tests := []struct {
+		faults impalatest.Faults
+		err    bool
+	}{
+		{faults: impalatest.Faults{ResetAfter: 3}, err: true},
+		{faults: impalatest.Faults{ResetAfter: 8}},
+		{faults: impalatest.Faults{ResetAfter: total / 2}, err: true},
+		{faults: impalatest.Faults{ResetAfter: total - 1}, err: true},
+		{faults: impalatest.Faults{WriteResetAfter: 10}, err: true},
+		{faults: impalatest.Faults{WriteResetAfter: 200}, err: true},
+	}
+
+	for _, tt := range tests {
+		f := tt.faults
+		db := faultDB(t, srv, faultOnce(f))
+		db.SetMaxOpenConns(1)
+
+		if err := queryAll(t, db); (err != nil) != tt.err {
+			t.Errorf("%+v: got error %v, expected error %v", f, err, tt.err)
+		}
+		// broken connection is discarded
+		if err := queryAll(t, db); err != nil {
+			t.Errorf("%+v: query after reset: %v", f, err)
+		}
+		db.Close()
+	}
+}
+
+func TestFaultTruncate(t *testing.T) {
+	srv := faultServer(t)
+	total := int64(len(cleanSession(t, srv)))
+
+	for n := int64(1); n < total; n++ {
+		db := faultDB(t, srv, impalatest.Faults{TruncateAfter: n}.Wrap)
+		if err := queryAll(t, db); err == nil {
+			t.Errorf("truncate after %d of %d bytes: expected error", n, total)
+		}
+		db.Close()
+	}
+}
+
+func TestFaultCorrupt(t *testing.T) {
+	srv := faultServer(t)
+	raw := cleanSession(t, srv)
+
+	// negotiation status
+	db := faultDB(t, srv, impalatest.Faults{Corrupt: map[int64]byte{0: 0xff}}.Wrap)
+	if err := queryAll(t, db); err == nil {
+		t.Error("corrupted negotiation status: expected error")
+	}
+	db.Close()
+
+	// message header of the first frame, which follows 5 bytes of negotiation
+	// and 4 bytes of frame length. Reads beyond the frame end with EOF
+	if len(raw) < 9 {
+		t.Fatalf("unexpected session: %x", raw)
+	}
+	end := 9 + int64(binary.BigEndian.Uint32(raw[5:9]))
+	for off := int64(9); off < 9+24 && off < end; off++ {
+		f := impalatest.Faults{Corrupt: map[int64]byte{off: 0xff}, TruncateAfter: end}
+		db := faultDB(t, srv, f.Wrap)
+		if err := queryAll(t, db); err == nil {
+			t.Errorf("corrupted byte %d: expected error", off)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,35 @@
+package impala
+
+import (
+	"context"
+	"net"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// DialFB303 connects to fb303 service at host:port, e.g. of metastore, with
+// dialer, TLS and timeouts of options, and returns thrift client of the
+// connection and its transport, which closes it. SASL is not negotiated
+func DialFB303(ctx context.Context, opts *Options, addr string) (thrift.TClient, thrift.TTransport, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := *opts
+	o.Host, o.Port = host, port
+
+	if o.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.ConnectTimeout)
+		defer cancel()
+	}
+	conn, err := dialConn(ctx, &o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	socket := thrift.NewTSocketFromConnTimeout(conn, o.SocketTimeout)
+	transport := thrift.NewTBufferedTransport(socket, o.BufferSize)
+	protocol := thrift.NewTBinaryProtocol(transport, false, true)
+	return thrift.NewTStandardClient(protocol, protocol), transport, nil
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/fb303"
+)
+
+// FB303 checks health of services implementing fb303 FacebookService
+type FB303 struct {
+	client *fb303.FacebookServiceClient
+	now    func() time.Time
+}
+
+// NewFB303 creates fb303 health checker
+func NewFB303(client thrift.TClient) *FB303 {
+	return &FB303{
+		client: fb303.NewFacebookServiceClient(client),
+		now:    time.Now,
+	}
+}
+
+// Check queries status, version, uptime and counters
+func (f *FB303) Check(ctx context.Context) (*Report, error) {
+	name, err := f.client.GetName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := f.client.GetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := f.client.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := f.client.GetStatusDetails(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	since, err := f.client.AliveSince(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counters, err := f.client.GetCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{
+		Name:          name,
+		Version:       version,
+		Status:        status.String(),
+		StatusDetails: details,
+		Counters:      counters,
+	}
+
+	if since > 0 {
+		r.AliveSince = time.Unix(since, 0)
+		r.UptimeSeconds = int64(f.now().Sub(r.AliveSince) / time.Second)
+	}
+	return r, nil
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Report describes server health
+type Report struct {
+	Name          string           `json:"name"`
+	Version       string           `json:"version,omitempty"`
+	Status        string           `json:"status"`
+	StatusDetails string           `json:"status_details,omitempty"`
+	AliveSince    time.Time        `json:"alive_since,omitzero"`
+	UptimeSeconds int64            `json:"uptime_seconds,omitempty"`
+	Counters      map[string]int64 `json:"counters,omitempty"`
+}
+
+// Checker queries server health
+type Checker interface {
+	Check(ctx context.Context) (*Report, error)
+}
+
+// Uptime returns time elapsed since server start.
+// Zero if server does not report its start time
+func (r *Report) Uptime() time.Duration {
+	return time.Duration(r.UptimeSeconds) * time.Second
+}
+
+// WriteText writes human readable report
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "name:\t%s\n", r.Name)
+	if r.Version != "" {
+		fmt.Fprintf(tw, "version:\t%s\n", r.Version)
+	}
+	fmt.Fprintf(tw, "status:\t%s\n", r.Status)
+	if r.StatusDetails != "" {
+		fmt.Fprintf(tw, "details:\t%s\n", r.StatusDetails)
+	}
+	if !r.AliveSince.IsZero() {
+		fmt.Fprintf(tw, "alive since:\t%s\n", r.AliveSince.Format(time.RFC3339))
+		fmt.Fprintf(tw, "uptime:\t%s\n", r.Uptime())
+	}
+
+	if len(r.Counters) > 0 {
+		fmt.Fprintf(tw, "counters:\n")
+
+		keys := make([]string, 0, len(r.Counters))
+		for k := range r.Counters {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(tw, "  %s\t%d\n", k, r.Counters[k])
+		}
+	}
+	return tw.Flush()
+}
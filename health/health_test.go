@@ -0,0 +1,51 @@
+package health
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	r := &Report{
+		Name:          "impalad",
+		Version:       "3.2.0",
+		Status:        StatusAlive,
+		AliveSince:    time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC),
+		UptimeSeconds: 90,
+		Counters:      map[string]int64{"b.requests": 2, "a.errors": 1},
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `name:         impalad
+version:      3.2.0
+status:       ALIVE
+alive since:  2019-01-01T12:00:00Z
+uptime:       1m30s
+counters:
+  a.errors    1
+  b.requests  2
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	r := &Report{Name: "hiveserver2", Version: "3.2.0", Status: StatusAlive}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"name":"hiveserver2","version":"3.2.0","status":"ALIVE"}`
+	if string(b) != want {
+		t.Errorf("got: %s, want: %s", b, want)
+	}
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+
+	"github.com/bippio/go-impala/hive"
+)
+
+// StatusAlive is reported when server responds to requests
+const StatusAlive = "ALIVE"
+
+// HiveServer2 checks health of HiveServer2 using GetInfo requests.
+// HiveServer2 does not report uptime and counters
+type HiveServer2 struct {
+	session *hive.Session
+}
+
+// NewHiveServer2 creates HiveServer2 health checker
+func NewHiveServer2(session *hive.Session) *HiveServer2 {
+	return &HiveServer2{session: session}
+}
+
+// Check queries server name and version
+func (h *HiveServer2) Check(ctx context.Context) (*Report, error) {
+	info, err := h.session.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Report{
+		Name:    info.ServerName,
+		Version: info.DBMSVersion,
+		Status:  StatusAlive,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package impala
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialFB303(t *testing.T) {
+	if _, _, err := DialFB303(context.Background(), &DefaultOptions, "localhost"); err == nil {
+		t.Error("expected error for address without port")
+	}
+
+	// server which never completes TLS handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	opts := DefaultOptions
+	opts.UseTLS = true
+	opts.ConnectTimeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, _, err := DialFB303(context.Background(), &opts, l.Addr().String()); err == nil {
+		t.Error("expected handshake error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial took %v, want connect timeout honored", elapsed)
+	}
+}
@@ -2,18 +2,23 @@ package hive
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"strconv"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/metrics"
 	"github.com/bippio/go-impala/services/cli_service"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client represents Hive Client
 type Client struct {
-	client *cli_service.TCLIServiceClient
-	opts   *Options
-	log    *log.Logger
+	client  *cli_service.TCLIServiceClient
+	opts    *Options
+	log     *slog.Logger
+	info    *ServerInfo
+	tracer  trace.Tracer
+	metrics metrics.Hook
 }
 
 // Options for Hive Client
@@ -21,24 +26,53 @@ type Options struct {
 	MaxRows      int64
 	MemLimit     string
 	QueryTimeout int
+
+	// TracerProvider for OpenTelemetry spans. Global provider is used if nil
+	TracerProvider trace.TracerProvider
+	// Metrics receives session, statement and fetch metrics
+	Metrics metrics.Hook
 }
 
 // NewClient creates Hive Client
-func NewClient(client thrift.TClient, log *log.Logger, opts *Options) *Client {
+func NewClient(client thrift.TClient, log *slog.Logger, opts *Options) *Client {
+	hook := opts.Metrics
+	if hook == nil {
+		hook = metrics.Nop{}
+	}
+
 	return &Client{
-		client: cli_service.NewTCLIServiceClient(client),
-		log:    log,
-		opts:   opts,
+		client:  cli_service.NewTCLIServiceClient(client),
+		log:     log,
+		opts:    opts,
+		tracer:  newTracer(opts.TracerProvider),
+		metrics: hook,
 	}
 }
 
+// ConfImpersonateUser is session configuration of user whom statements
+// are executed as, if the connected user is authorized to impersonate
+const ConfImpersonateUser = "impala.doas.user"
+
+// ConfUseDatabase is session configuration of default database
+const ConfUseDatabase = "use:database"
+
 // OpenSession creates new hive session
 func (c *Client) OpenSession(ctx context.Context) (*Session, error) {
+	return c.OpenSessionWithConfig(ctx, nil)
+}
+
+// OpenSessionWithConfig creates new hive session with additional configuration
+func (c *Client) OpenSessionWithConfig(ctx context.Context, conf map[string]string) (_ *Session, err error) {
+	ctx, span := c.startSpan(ctx, "hive.OpenSession")
+	defer func() { endSpan(span, err) }()
 
 	cfg := map[string]string{
-		"MEM_LIMIT":     c.opts.MemLimit,
+		"MEM_LIMIT":       c.opts.MemLimit,
 		"QUERY_TIMEOUT_S": strconv.Itoa(c.opts.QueryTimeout),
 	}
+	for k, v := range conf {
+		cfg[k] = v
+	}
 
 	req := cli_service.TOpenSessionReq{
 		ClientProtocol: cli_service.TProtocolVersion_HIVE_CLI_SERVICE_PROTOCOL_V7,
@@ -52,8 +86,27 @@ func (c *Client) OpenSession(ctx context.Context) (*Session, error) {
 	if err := checkStatus(resp); err != nil {
 		return nil, err
 	}
+	if resp.SessionHandle == nil || resp.SessionHandle.SessionId == nil {
+		return nil, errNoHandle
+	}
 
-	c.log.Printf("open session: %s", guid(resp.SessionHandle.GetSessionId().GUID))
-	c.log.Printf("session config: %v", resp.Configuration)
+	c.log.DebugContext(ctx, "open session", "session", guid(resp.SessionHandle.GetSessionId().GUID), "config", resp.Configuration)
+	span.SetAttributes(AttrSession.String(guid(resp.SessionHandle.GetSessionId().GUID)))
+	c.metrics.SessionOpened()
 	return &Session{h: resp.SessionHandle, hive: c}, nil
 }
+
+// ServerInfo returns information about server cached by Session.Info.
+// Nil if it was not fetched yet
+func (c *Client) ServerInfo() *ServerInfo {
+	return c.info
+}
+
+// Features returns features supported by server, as known from ServerInfo.
+// No features are reported before server info is fetched
+func (c *Client) Features() Features {
+	if c.info == nil {
+		return Features{}
+	}
+	return c.info.Features()
+}
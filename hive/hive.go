@@ -3,7 +3,6 @@ package hive
 import (
 	"errors"
 	"fmt"
-	"log"
 
 	"github.com/bippio/go-impala/services/cli_service"
 )
@@ -11,8 +10,16 @@ import (
 const (
 	// TimestampFormat is JDBC compliant timestamp format
 	TimestampFormat = "2006-01-02 15:04:05.999999999"
+	// DateFormat is JDBC compliant date format
+	DateFormat = "2006-01-02"
 )
 
+// ErrInvalidHandle means session or operation handle is not known to the server
+var ErrInvalidHandle = errors.New("thrift: invalid handle")
+
+// errNoHandle means successful response without handle
+var errNoHandle = errors.New("hive: response without handle")
+
 // RPCResponse respresents thrift rpc response
 type RPCResponse interface {
 	GetStatus() *cli_service.TStatus
@@ -26,17 +33,19 @@ func checkStatus(resp interface{}) error {
 			return errors.New(status.GetErrorMessage())
 		}
 		if status.StatusCode == cli_service.TStatusCode_INVALID_HANDLE_STATUS {
-			return errors.New("thrift: invalid handle")
+			return ErrInvalidHandle
 		}
 
 		// SUCCESS, SUCCESS_WITH_INFO, STILL_EXECUTING are ok
 		return nil
 	}
 
-	log.Printf("response: %v", resp)
-	return errors.New("thrift: invalid response")
+	return fmt.Errorf("thrift: invalid response %T", resp)
 }
 
 func guid(b []byte) string {
+	if len(b) != 16 {
+		return fmt.Sprintf("%x", b)
+	}
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
@@ -0,0 +1,154 @@
+package hive
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+// ServerInfo describes hive server
+type ServerInfo struct {
+	DBMSName    string
+	DBMSVersion string
+	ServerName  string
+
+	// Version parsed from DBMSVersion
+	Version Version
+}
+
+// Features supported by server
+type Features struct {
+	// AsyncFetch is set when FetchResults blocks for at most
+	// FETCH_ROWS_TIMEOUT_MS while rows are not ready, and then returns empty
+	// batch with more rows, so that client fetches again without pause
+	AsyncFetch bool
+	// RuntimeProfile is set when server implements GetRuntimeProfile rpc
+	RuntimeProfile bool
+	// DateType is set when server supports DATE type
+	DateType bool
+}
+
+// Impala versions introducing features
+var (
+	impalaAsyncFetch     = Version{Major: 3, Minor: 4}
+	impalaRuntimeProfile = Version{Major: 3, Minor: 1}
+	impalaDateType       = Version{Major: 3, Minor: 3}
+)
+
+// Info returns server information. It is fetched once per client and cached
+func (s *Session) Info(ctx context.Context) (*ServerInfo, error) {
+	if s.hive.info != nil {
+		return s.hive.info, nil
+	}
+
+	name, err := s.GetInfo(ctx, cli_service.TGetInfoType_CLI_DBMS_NAME)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.GetInfo(ctx, cli_service.TGetInfoType_CLI_DBMS_VER)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := s.GetInfo(ctx, cli_service.TGetInfoType_CLI_SERVER_NAME)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{
+		DBMSName:    name.GetStringValue(),
+		DBMSVersion: version.GetStringValue(),
+		ServerName:  server.GetStringValue(),
+	}
+
+	v, err := ParseVersion(info.DBMSVersion)
+	if err != nil {
+		s.hive.log.WarnContext(ctx, "server info", "error", err)
+	}
+	info.Version = v
+
+	s.hive.info = info
+	s.hive.log.DebugContext(ctx, "server info", "dbms", info.DBMSName, "version", info.Version, "features", info.Features())
+	return info, nil
+}
+
+// IsImpala returns whether server is impala daemon
+func (i *ServerInfo) IsImpala() bool {
+	return strings.Contains(strings.ToLower(i.DBMSName), "impala")
+}
+
+// Features returns features supported by server
+func (i *ServerInfo) Features() Features {
+	if !i.IsImpala() {
+		// HiveServer2 supports DATE type since 0.12
+		return Features{DateType: true}
+	}
+
+	return Features{
+		AsyncFetch:     i.Version.AtLeast(impalaAsyncFetch),
+		RuntimeProfile: i.Version.AtLeast(impalaRuntimeProfile),
+		DateType:       i.Version.AtLeast(impalaDateType),
+	}
+}
+
+// Version is comparable server version
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+var versionRe = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion extracts version from string such as
+// "impalad version 3.2.0-cdh6.3.2 RELEASE (build ...)"
+func ParseVersion(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("hive: version not recognized: %q", s)
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to or greater than o
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Major != o.Major:
+		return cmp(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return cmp(v.Minor, o.Minor)
+	default:
+		return cmp(v.Patch, o.Patch)
+	}
+}
+
+// AtLeast returns whether v is equal to or greater than o
+func (v Version) AtLeast(o Version) bool {
+	return v.Compare(o) >= 0
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func cmp(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
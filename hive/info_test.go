@@ -0,0 +1,84 @@
+package hive
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Version
+	}{
+		{in: "impalad version 3.2.0-cdh6.3.2 RELEASE (build 1bb9836227301b839a32c6bc230e35439d5984ac)", out: Version{3, 2, 0}},
+		{in: "3.4.0-SNAPSHOT", out: Version{3, 4, 0}},
+		{in: "2.12", out: Version{2, 12, 0}},
+		{in: "3.1.3000.7.1.7.0-551", out: Version{3, 1, 3000}},
+	}
+
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.in, err)
+			continue
+		}
+		if v != tt.out {
+			t.Errorf("ParseVersion(%q) = %v, want: %v", tt.in, v, tt.out)
+		}
+	}
+
+	if _, err := ParseVersion("unknown"); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		res  int
+	}{
+		{a: Version{3, 2, 0}, b: Version{3, 2, 0}, res: 0},
+		{a: Version{3, 2, 0}, b: Version{3, 3, 0}, res: -1},
+		{a: Version{4, 0, 0}, b: Version{3, 4, 1}, res: 1},
+		{a: Version{2, 12, 1}, b: Version{2, 12, 0}, res: 1},
+	}
+
+	for _, tt := range tests {
+		if res := tt.a.Compare(tt.b); res != tt.res {
+			t.Errorf("%v.Compare(%v) = %d, want: %d", tt.a, tt.b, res, tt.res)
+		}
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		info ServerInfo
+		out  Features
+	}{
+		{
+			info: ServerInfo{DBMSName: "Impala", Version: Version{2, 12, 0}},
+			out:  Features{},
+		},
+		{
+			info: ServerInfo{DBMSName: "Impala", Version: Version{3, 1, 0}},
+			out:  Features{RuntimeProfile: true},
+		},
+		{
+			info: ServerInfo{DBMSName: "Impala", Version: Version{3, 3, 0}},
+			out:  Features{RuntimeProfile: true, DateType: true},
+		},
+		{
+			info: ServerInfo{DBMSName: "Impala", Version: Version{4, 0, 0}},
+			out:  Features{AsyncFetch: true, RuntimeProfile: true, DateType: true},
+		},
+		{
+			info: ServerInfo{DBMSName: "Apache Hive", Version: Version{3, 1, 2}},
+			out:  Features{DateType: true},
+		},
+	}
+
+	for _, tt := range tests {
+		if f := tt.info.Features(); f != tt.out {
+			t.Errorf("%s %v: got: %+v, want: %+v", tt.info.DBMSName, tt.info.Version, f, tt.out)
+		}
+	}
+}
@@ -2,15 +2,31 @@ package hive
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"time"
 
+	"github.com/bippio/go-impala/logging"
+	"github.com/bippio/go-impala/metrics"
 	"github.com/bippio/go-impala/services/cli_service"
 )
 
+// Intervals of polling for rows of servers without async fetch
+const (
+	minPollInterval = 10 * time.Millisecond
+	maxPollInterval = time.Second
+)
+
 // Operation represents hive operation
 type Operation struct {
-	hive *Client
-	h    *cli_service.TOperationHandle
+	hive    *Client
+	session *Session
+	h       *cli_service.TOperationHandle
+
+	rows     int64
+	batches  int
+	start    time.Time
+	finished bool
 }
 
 // HasResultSet return if operation has result set
@@ -25,16 +41,18 @@ func (op *Operation) RowsAffected() float64 {
 
 // GetResultSetMetadata return schema
 func (op *Operation) GetResultSetMetadata(ctx context.Context) (*TableSchema, error) {
-	op.hive.log.Printf("fetch metadata for operation: %v", guid(op.h.OperationId.GUID))
+	op.hive.log.DebugContext(ctx, "fetch metadata", "operation", guid(op.h.OperationId.GUID))
 	req := cli_service.TGetResultSetMetadataReq{
 		OperationHandle: op.h,
 	}
 
 	resp, err := op.hive.client.GetResultSetMetadata(ctx, &req)
 	if err != nil {
+		op.finish(outcome(ctx, err))
 		return nil, err
 	}
 	if err := checkStatus(resp); err != nil {
+		op.finish(outcome(ctx, err))
 		return nil, err
 	}
 
@@ -42,18 +60,27 @@ func (op *Operation) GetResultSetMetadata(ctx context.Context) (*TableSchema, er
 
 	if resp.IsSetSchema() {
 		for _, desc := range resp.Schema.Columns {
+			if desc.TypeDesc == nil || len(desc.TypeDesc.Types) == 0 || desc.TypeDesc.Types[0].PrimitiveEntry == nil {
+				err := fmt.Errorf("hive: unsupported type of column %s", desc.ColumnName)
+				op.finish(metrics.OutcomeError)
+				return nil, err
+			}
 			entry := desc.TypeDesc.Types[0].PrimitiveEntry
 
 			dbtype := strings.TrimSuffix(entry.Type.String(), "_TYPE")
+			scantype := typeOf(entry)
+			if entry.Type == cli_service.TTypeId_DATE_TYPE && !op.features(ctx).DateType {
+				scantype = dataTypeString
+			}
 			schema.Columns = append(schema.Columns, &ColDesc{
 				Name:             desc.ColumnName,
 				DatabaseTypeName: dbtype,
-				ScanType:         typeOf(entry),
+				ScanType:         scantype,
 			})
 		}
 
 		for _, col := range schema.Columns {
-			op.hive.log.Printf("fetch schema: %v", col)
+			op.hive.log.DebugContext(ctx, "fetch schema", "column", col.Name, "type", col.DatabaseTypeName)
 		}
 	}
 
@@ -69,39 +96,102 @@ func (op *Operation) FetchResults(ctx context.Context, schema *TableSchema) (*Re
 	}
 
 	rs := ResultSet{
-		idx:     0,
-		length:  length(resp.Results),
-		result:  resp.Results,
-		more:    resp.GetHasMoreRows(),
-		schema:  schema,
-		fetchfn: func() (*cli_service.TFetchResultsResp, error) { return fetch(ctx, op, schema) },
+		idx:       0,
+		operation: op,
+		wait:      func(polls int) error { return op.wait(ctx, polls) },
+		length:    length(resp.Results),
+		result:    resp.Results,
+		more:      resp.GetHasMoreRows(),
+		schema:    schema,
+		fetchfn:   func() (*cli_service.TFetchResultsResp, error) { return fetch(ctx, op, schema) },
 	}
 
 	return &rs, nil
 }
 
-func fetch(ctx context.Context, op *Operation, schema *TableSchema) (*cli_service.TFetchResultsResp, error) {
+func fetch(ctx context.Context, op *Operation, schema *TableSchema) (_ *cli_service.TFetchResultsResp, err error) {
+	ctx, span := op.hive.startSpan(ctx, "hive.FetchResults",
+		AttrOperation.String(guid(op.h.OperationId.GUID)),
+		AttrBatch.Int(op.batches+1),
+	)
+	defer func() { endSpan(span, err) }()
+
 	req := cli_service.TFetchResultsReq{
 		OperationHandle: op.h,
 		MaxRows:         op.hive.opts.MaxRows,
 	}
 
-	op.hive.log.Printf("fetch results for operation: %v", guid(op.h.OperationId.GUID))
+	op.hive.log.DebugContext(ctx, "fetch results", "operation", guid(op.h.OperationId.GUID))
 
 	resp, err := op.hive.client.FetchResults(ctx, &req)
 	if err != nil {
+		op.finish(outcome(ctx, err))
 		return nil, err
 	}
 	if err := checkStatus(resp); err != nil {
+		op.finish(outcome(ctx, err))
 		return nil, err
 	}
 
-	op.hive.log.Printf("results: %v", resp.Results)
+	n := length(resp.Results)
+	op.hive.metrics.FetchRoundTrip()
+	op.hive.metrics.RowsReceived(n)
+	op.rows += int64(n)
+	op.batches++
+	span.SetAttributes(AttrRows.Int(n))
+
+	op.hive.log.Log(ctx, logging.LevelTrace, "results", "results", resp.Results)
 	return resp, nil
 }
 
+// features returns features of server, fetching its info when needed
+func (op *Operation) features(ctx context.Context) Features {
+	if op.session == nil || op.hive.info != nil {
+		return op.hive.Features()
+	}
+	if _, err := op.session.Info(ctx); err != nil {
+		op.hive.log.WarnContext(ctx, "failed to fetch server info", "error", err)
+	}
+	return op.hive.Features()
+}
+
+// wait pauses before fetching again after empty batch. Servers with async
+// fetch already block FetchResults for FETCH_ROWS_TIMEOUT_MS before returning
+// empty batch, so they are fetched again at once. Others are polled with backoff
+func (op *Operation) wait(ctx context.Context, polls int) error {
+	if op.features(ctx).AsyncFetch {
+		return nil
+	}
+
+	d := minPollInterval
+	for i := 0; i < polls && d < maxPollInterval; i++ {
+		d *= 2
+	}
+	if d > maxPollInterval {
+		d = maxPollInterval
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		op.finish(metrics.OutcomeCanceled)
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 // Close closes operation
-func (op *Operation) Close(ctx context.Context) error {
+func (op *Operation) Close(ctx context.Context) (err error) {
+	ctx, span := op.hive.startSpan(ctx, "hive.CloseOperation",
+		AttrOperation.String(guid(op.h.OperationId.GUID)),
+		AttrTotalRows.Int64(op.rows),
+		AttrTotalBatches.Int(op.batches),
+	)
+	defer func() { endSpan(span, err) }()
+
+	op.finish(metrics.OutcomeSuccess)
 	req := cli_service.TCloseOperationReq{
 		OperationHandle: op.h,
 	}
@@ -113,6 +203,22 @@ func (op *Operation) Close(ctx context.Context) error {
 		return err
 	}
 
-	op.hive.log.Printf("close operation: %v", guid(op.h.OperationId.GUID))
+	op.hive.log.DebugContext(ctx, "close operation", "operation", guid(op.h.OperationId.GUID))
 	return nil
 }
+
+// finish reports statement outcome once
+func (op *Operation) finish(outcome metrics.Outcome) {
+	if op.finished {
+		return
+	}
+	op.finished = true
+	op.hive.metrics.StatementFinished(outcome)
+}
+
+func outcome(ctx context.Context, err error) metrics.Outcome {
+	if err != nil && ctx.Err() != nil {
+		return metrics.OutcomeCanceled
+	}
+	return metrics.OutcomeOf(err)
+}
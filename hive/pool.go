@@ -0,0 +1,443 @@
+package hive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+// ErrPoolClosed is returned by Acquire after pool is closed
+var ErrPoolClosed = errors.New("hive: pool is closed")
+
+// DialFunc opens connection and returns its client and transport, which
+// closes it
+type DialFunc func(ctx context.Context) (*Client, thrift.TTransport, error)
+
+// PoolOptions configures Pool
+type PoolOptions struct {
+	// MaxOpen is maximum number of connections in use. Acquire waits for
+	// release when it is reached. Zero means 10
+	MaxOpen int
+	// MinIdle is number of idle connections opened in advance by health check
+	MinIdle int
+	// MaxLifetime limits age of connection. Zero means no limit
+	MaxLifetime time.Duration
+	// HealthCheckPeriod is interval of pinging idle connections. Zero means
+	// one minute, negative disables health checks
+	HealthCheckPeriod time.Duration
+	// AcquireTimeout limits Acquire whose context has no deadline. Zero means no limit
+	AcquireTimeout time.Duration
+	// Config is configuration of every session, e.g. ConfUseDatabase
+	Config map[string]string
+}
+
+// Pool keeps connections with open session for reuse. Each connection has
+// single session, which is used by one goroutine at a time
+type Pool struct {
+	dial DialFunc
+	opts PoolOptions
+
+	// sem holds token of every acquired connection
+	sem  chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex
+	idle   []*poolConn
+	open   int
+	closed bool
+}
+
+type poolConn struct {
+	t       thrift.TTransport
+	session *Session
+	created time.Time
+}
+
+// PoolStats describes connections of pool
+type PoolStats struct {
+	Open  int
+	Idle  int
+	InUse int
+}
+
+// NewPool creates pool which opens connections with dial
+func NewPool(dial DialFunc, opts *PoolOptions) *Pool {
+	p := &Pool{dial: dial, done: make(chan struct{})}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.MaxOpen <= 0 {
+		p.opts.MaxOpen = 10
+	}
+	if p.opts.HealthCheckPeriod == 0 {
+		p.opts.HealthCheckPeriod = time.Minute
+	}
+	p.sem = make(chan struct{}, p.opts.MaxOpen)
+
+	if p.opts.HealthCheckPeriod > 0 {
+		p.wg.Add(1)
+		go p.healthCheck()
+	}
+	return p
+}
+
+// Acquire returns session of idle connection, or of new one if there is
+// none. It waits for release of a connection when MaxOpen are in use, until
+// context is done
+func (p *Pool) Acquire(ctx context.Context) (*PooledSession, error) {
+	if _, ok := ctx.Deadline(); !ok && p.opts.AcquireTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.AcquireTimeout)
+		defer cancel()
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, fmt.Errorf("hive: acquire session: %w", ctx.Err())
+	}
+
+	for {
+		c, err := p.popIdle()
+		if err != nil {
+			<-p.sem
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+		if p.expired(c) {
+			p.closeConn(c, true)
+			continue
+		}
+		return &PooledSession{pool: p, conn: c}, nil
+	}
+
+	p.mu.Lock()
+	p.open++
+	p.mu.Unlock()
+	c, err := p.connect(ctx)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return &PooledSession{pool: p, conn: c}, nil
+}
+
+// Stats returns number of connections
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{Open: p.open, Idle: len(p.idle), InUse: p.open - len(p.idle)}
+}
+
+// Close closes idle connections and stops health check. Connections in use
+// are closed when released
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+	for _, c := range idle {
+		p.closeConn(c, true)
+	}
+	return nil
+}
+
+// popIdle returns the most recently used idle connection, nil if there is none
+func (p *Pool) popIdle() (*poolConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	if len(p.idle) == 0 {
+		return nil, nil
+	}
+	c := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return c, nil
+}
+
+// connect opens connection and its session. Caller counts it as open
+func (p *Pool) connect(ctx context.Context) (*poolConn, error) {
+	client, t, err := p.dial(ctx)
+	if err != nil {
+		p.dropConn()
+		return nil, err
+	}
+	session, err := client.OpenSessionWithConfig(ctx, p.opts.Config)
+	if err != nil {
+		t.Close()
+		p.dropConn()
+		return nil, err
+	}
+	return &poolConn{t: t, session: session, created: time.Now()}, nil
+}
+
+// release returns connection to idle ones, or closes it if it is broken,
+// expired or pool is closed
+func (p *Pool) release(c *poolConn, broken bool) {
+	defer func() { <-p.sem }()
+	if broken {
+		p.closeConn(c, false)
+		return
+	}
+
+	p.mu.Lock()
+	if !p.closed && !p.expired(c) {
+		p.idle = append(p.idle, c)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	p.closeConn(c, true)
+}
+
+// closeConn removes connection from pool and closes it, and its session if
+// connection is usable, in background, so that unresponsive server does not
+// block Acquire, release or Close
+func (p *Pool) closeConn(c *poolConn, usable bool) {
+	p.dropConn()
+	go func() {
+		if usable {
+			c.session.Close(context.Background())
+		}
+		c.t.Close()
+	}()
+}
+
+func (p *Pool) dropConn() {
+	p.mu.Lock()
+	p.open--
+	p.mu.Unlock()
+}
+
+func (p *Pool) expired(c *poolConn) bool {
+	return p.opts.MaxLifetime > 0 && time.Since(c.created) >= p.opts.MaxLifetime
+}
+
+// healthCheck periodically pings idle connections, closes broken and
+// expired ones, and opens connections up to MinIdle
+func (p *Pool) healthCheck() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.opts.HealthCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		p.check()
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Pool) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.HealthCheckPeriod)
+	defer cancel()
+
+	p.mu.Lock()
+	idle := append([]*poolConn(nil), p.idle...)
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		// connection being checked holds token, so that it counts toward
+		// MaxOpen while it is not available to Acquire
+		select {
+		case p.sem <- struct{}{}:
+		default:
+			return
+		}
+		p.checkConn(ctx, c)
+		<-p.sem
+	}
+
+	for {
+		p.mu.Lock()
+		full := p.closed || len(p.idle) >= p.opts.MinIdle || p.open >= p.opts.MaxOpen
+		if !full {
+			p.open++
+		}
+		p.mu.Unlock()
+		if full {
+			return
+		}
+		c, err := p.connect(ctx)
+		if err != nil {
+			return
+		}
+		p.putIdle(c)
+	}
+}
+
+// checkConn pings idle connection, unless it was acquired meanwhile, and
+// closes it if it is broken or expired
+func (p *Pool) checkConn(ctx context.Context, c *poolConn) {
+	if !p.removeIdle(c) {
+		return
+	}
+	switch {
+	case p.expired(c):
+		p.closeConn(c, true)
+	case c.session.Ping(ctx) != nil:
+		p.closeConn(c, false)
+	default:
+		p.putIdle(c)
+	}
+}
+
+// removeIdle removes connection from idle ones. It reports false if the
+// connection is not idle
+func (p *Pool) removeIdle(c *poolConn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, ic := range p.idle {
+		if ic == c {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// putIdle adds connections to idle ones, or closes them if pool is closed
+func (p *Pool) putIdle(conns ...*poolConn) {
+	p.mu.Lock()
+	if !p.closed {
+		// checked connections are used after ones released meanwhile
+		p.idle = append(conns, p.idle...)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	for _, c := range conns {
+		p.closeConn(c, true)
+	}
+}
+
+// ErrReleased is returned by methods of PooledSession after it is released
+var ErrReleased = errors.New("hive: session is released to pool")
+
+// PooledSession is session of connection acquired from pool. It must be
+// released, or discarded after transport error. The session is closed by
+// pool, so PooledSession has no Close
+type PooledSession struct {
+	pool *Pool
+	conn *poolConn
+}
+
+// session returns session of acquired connection
+func (s *PooledSession) session() (*Session, error) {
+	if s.conn == nil {
+		return nil, ErrReleased
+	}
+	return s.conn.session, nil
+}
+
+// ExecuteStatement returns hive operation
+func (s *PooledSession) ExecuteStatement(ctx context.Context, stmt string) (*Operation, error) {
+	session, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	return session.ExecuteStatement(ctx, stmt)
+}
+
+// Ping checks the connection
+func (s *PooledSession) Ping(ctx context.Context) error {
+	session, err := s.session()
+	if err != nil {
+		return err
+	}
+	return session.Ping(ctx)
+}
+
+// GetInfo returns server information of given type
+func (s *PooledSession) GetInfo(ctx context.Context, typ cli_service.TGetInfoType) (*cli_service.TGetInfoValue, error) {
+	session, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	return session.GetInfo(ctx, typ)
+}
+
+// Info returns server information
+func (s *PooledSession) Info(ctx context.Context) (*ServerInfo, error) {
+	session, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	return session.Info(ctx)
+}
+
+// GetDelegationToken obtains delegation token for owner, which renewer may renew
+func (s *PooledSession) GetDelegationToken(ctx context.Context, owner string, renewer string) (string, error) {
+	session, err := s.session()
+	if err != nil {
+		return "", err
+	}
+	return session.GetDelegationToken(ctx, owner, renewer)
+}
+
+// RenewDelegationToken extends lifetime of delegation token
+func (s *PooledSession) RenewDelegationToken(ctx context.Context, token string) error {
+	session, err := s.session()
+	if err != nil {
+		return err
+	}
+	return session.RenewDelegationToken(ctx, token)
+}
+
+// CancelDelegationToken invalidates delegation token
+func (s *PooledSession) CancelDelegationToken(ctx context.Context, token string) error {
+	session, err := s.session()
+	if err != nil {
+		return err
+	}
+	return session.CancelDelegationToken(ctx, token)
+}
+
+// Client returns client of the connection, e.g. for ServerInfo. Nil after release
+func (s *PooledSession) Client() *Client {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.session.hive
+}
+
+// Release returns connection to pool
+func (s *PooledSession) Release() {
+	s.done(false)
+}
+
+// Discard closes connection, whose state is unknown, e.g. after transport error
+func (s *PooledSession) Discard() {
+	s.done(true)
+}
+
+func (s *PooledSession) done(broken bool) {
+	if s.conn == nil {
+		return
+	}
+	c := s.conn
+	s.conn = nil
+	s.pool.release(c, broken)
+}
@@ -2,9 +2,11 @@ package hive
 
 import (
 	"database/sql/driver"
+	"fmt"
 	"io"
 	"time"
 
+	"github.com/bippio/go-impala/metrics"
 	"github.com/bippio/go-impala/services/cli_service"
 )
 
@@ -14,19 +16,30 @@ type ResultSet struct {
 	length  int
 	fetchfn func() (*cli_service.TFetchResultsResp, error)
 	schema  *TableSchema
+	// wait pauses before fetching again after given number of empty batches
+	wait func(polls int) error
 
 	operation *Operation
 	result    *cli_service.TRowSet
 	more      bool
+	rows      int64
 }
 
 // Next ...
 func (rs *ResultSet) Next(dest []driver.Value) error {
-	if rs.idx >= rs.length {
+	// server returns empty batches while rows are not ready yet
+	for polls := 0; rs.idx >= rs.length; polls++ {
 		if !rs.more {
+			rs.fetched()
 			return io.EOF
 		}
 
+		if polls > 0 && rs.wait != nil {
+			if err := rs.wait(polls - 1); err != nil {
+				return err
+			}
+		}
+
 		resp, err := rs.fetchfn()
 		if err != nil {
 			return err
@@ -37,60 +50,119 @@ func (rs *ResultSet) Next(dest []driver.Value) error {
 		rs.length = length(rs.result)
 	}
 
-	if rs.length == 0 {
-		return io.EOF
+	if len(rs.result.Columns) < len(dest) || len(rs.schema.Columns) < len(dest) {
+		if rs.operation != nil {
+			rs.operation.finish(metrics.OutcomeError)
+		}
+		return fmt.Errorf("hive: result has %d columns, expected %d", len(rs.result.Columns), len(dest))
 	}
 
 	for i := range dest {
 		val, err := value(rs.result.Columns[i], rs.schema.Columns[i], rs.idx)
 		if err != nil {
+			if rs.operation != nil {
+				rs.operation.finish(metrics.OutcomeError)
+			}
 			return err
 		}
 		dest[i] = val
 	}
 	rs.idx++
+	rs.rows++
+
+	if rs.rows == 1 && rs.operation != nil {
+		rs.operation.hive.metrics.ObserveLatency(metrics.PhaseFirstRow, time.Since(rs.operation.start))
+	}
 	return nil
 }
 
+// fetched reports full fetch latency once all rows are returned
+func (rs *ResultSet) fetched() {
+	if rs.operation == nil || rs.operation.finished {
+		return
+	}
+	rs.operation.hive.metrics.ObserveLatency(metrics.PhaseFetch, time.Since(rs.operation.start))
+	rs.operation.finish(metrics.OutcomeSuccess)
+}
+
 func value(col *cli_service.TColumn, cd *ColDesc, i int) (interface{}, error) {
 	switch cd.DatabaseTypeName {
 	case "STRING", "CHAR", "VARCHAR":
-		if col.StringVal.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.StringVal == nil || i >= len(col.StringVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.StringVal.Nulls, i) {
 			return nil, nil
 		}
 		return col.StringVal.Values[i], nil
 	case "TINYINT":
-		if col.ByteVal.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.ByteVal == nil || i >= len(col.ByteVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.ByteVal.Nulls, i) {
 			return nil, nil
 		}
 		return col.ByteVal.Values[i], nil
 	case "SMALLINT":
-		if col.I16Val.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.I16Val == nil || i >= len(col.I16Val.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.I16Val.Nulls, i) {
 			return nil, nil
 		}
 		return col.I16Val.Values[i], nil
 	case "INT":
-		if col.I32Val.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.I32Val == nil || i >= len(col.I32Val.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.I32Val.Nulls, i) {
 			return nil, nil
 		}
 		return col.I32Val.Values[i], nil
 	case "BIGINT":
-		if col.I64Val.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.I64Val == nil || i >= len(col.I64Val.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.I64Val.Nulls, i) {
 			return nil, nil
 		}
 		return col.I64Val.Values[i], nil
 	case "BOOLEAN":
-		if col.BoolVal.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.BoolVal == nil || i >= len(col.BoolVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.BoolVal.Nulls, i) {
 			return nil, nil
 		}
 		return col.BoolVal.Values[i], nil
 	case "FLOAT", "DOUBLE":
-		if col.DoubleVal.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.DoubleVal == nil || i >= len(col.DoubleVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.DoubleVal.Nulls, i) {
 			return nil, nil
 		}
 		return col.DoubleVal.Values[i], nil
+	case "DATE":
+		if col.StringVal == nil || i >= len(col.StringVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.StringVal.Nulls, i) {
+			return nil, nil
+		}
+		if cd.ScanType != dataTypeDateTime {
+			return col.StringVal.Values[i], nil
+		}
+		t, err := time.Parse(DateFormat, col.StringVal.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
 	case "TIMESTAMP", "DATETIME":
-		if col.StringVal.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.StringVal == nil || i >= len(col.StringVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.StringVal.Nulls, i) {
 			return nil, nil
 		}
 		t, err := time.Parse(TimestampFormat, col.StringVal.Values[i])
@@ -99,13 +171,24 @@ func value(col *cli_service.TColumn, cd *ColDesc, i int) (interface{}, error) {
 		}
 		return t, nil
 	default:
-		if col.StringVal.Nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+		if col.StringVal == nil || i >= len(col.StringVal.Values) {
+			return nil, malformed(cd)
+		}
+		if isNull(col.StringVal.Nulls, i) {
 			return nil, nil
 		}
 		return col.StringVal.Values[i], nil
 	}
 }
 
+func isNull(nulls []byte, i int) bool {
+	return i/8 < len(nulls) && nulls[i/8]&(1<<(uint(i)%8)) != 0
+}
+
+func malformed(cd *ColDesc) error {
+	return fmt.Errorf("hive: malformed %s column %s", cd.DatabaseTypeName, cd.Name)
+}
+
 func length(rs *cli_service.TRowSet) int {
 	if rs == nil {
 		return 0
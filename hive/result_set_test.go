@@ -0,0 +1,132 @@
+package hive
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+func dateRowSet(values ...string) *cli_service.TRowSet {
+	return &cli_service.TRowSet{
+		Columns: []*cli_service.TColumn{
+			{StringVal: &cli_service.TStringColumn{Values: values, Nulls: []byte{0}}},
+		},
+	}
+}
+
+func TestNextEmptyBatches(t *testing.T) {
+	batches := []*cli_service.TFetchResultsResp{
+		{Results: dateRowSet(), HasMoreRows: boolPtr(true)},
+		{Results: dateRowSet(), HasMoreRows: boolPtr(true)},
+		{Results: dateRowSet("2019-01-01"), HasMoreRows: boolPtr(false)},
+	}
+
+	var polls []int
+	rs := &ResultSet{
+		more:   true,
+		schema: &TableSchema{Columns: []*ColDesc{{Name: "d", DatabaseTypeName: "DATE", ScanType: dataTypeDateTime}}},
+		fetchfn: func() (*cli_service.TFetchResultsResp, error) {
+			resp := batches[0]
+			batches = batches[1:]
+			return resp, nil
+		},
+		wait: func(n int) error {
+			polls = append(polls, n)
+			return nil
+		},
+	}
+
+	dest := make([]driver.Value, 1)
+	if err := rs.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if dest[0] != want {
+		t.Errorf("got: %v, want: %v", dest[0], want)
+	}
+	if !reflect.DeepEqual(polls, []int{0, 1}) {
+		t.Errorf("waited after polls %v, want [0 1]", polls)
+	}
+
+	if err := rs.Next(dest); err != io.EOF {
+		t.Errorf("got: %v, want: %v", err, io.EOF)
+	}
+}
+
+func TestNextWaitError(t *testing.T) {
+	rs := &ResultSet{
+		more:   true,
+		schema: &TableSchema{Columns: []*ColDesc{{Name: "d", DatabaseTypeName: "DATE", ScanType: dataTypeDateTime}}},
+		fetchfn: func() (*cli_service.TFetchResultsResp, error) {
+			return &cli_service.TFetchResultsResp{Results: dateRowSet(), HasMoreRows: boolPtr(true)}, nil
+		},
+		wait: func(n int) error { return context.Canceled },
+	}
+
+	if err := rs.Next(make([]driver.Value, 1)); err != context.Canceled {
+		t.Errorf("got: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestNextDateWithoutDateType(t *testing.T) {
+	rs := &ResultSet{
+		length: 1,
+		result: dateRowSet("2019-01-01"),
+		schema: &TableSchema{Columns: []*ColDesc{{Name: "d", DatabaseTypeName: "DATE", ScanType: dataTypeString}}},
+	}
+
+	dest := make([]driver.Value, 1)
+	if err := rs.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest[0] != "2019-01-01" {
+		t.Errorf("got: %v, want: %v", dest[0], "2019-01-01")
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func TestNextMalformed(t *testing.T) {
+	intSchema := &TableSchema{Columns: []*ColDesc{{Name: "i", DatabaseTypeName: "INT", ScanType: dataTypeInt32}}}
+
+	tests := []struct {
+		name   string
+		result *cli_service.TRowSet
+		schema *TableSchema
+	}{
+		{
+			name:   "missing column",
+			result: &cli_service.TRowSet{},
+			schema: intSchema,
+		},
+		{
+			name:   "wrong column type",
+			result: dateRowSet("a"),
+			schema: intSchema,
+		},
+		{
+			name: "short column",
+			result: &cli_service.TRowSet{Columns: []*cli_service.TColumn{
+				{I32Val: &cli_service.TI32Column{Values: []int32{}, Nulls: []byte{}}},
+			}},
+			schema: intSchema,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := &ResultSet{length: 1, result: tt.result, schema: tt.schema}
+			if err := rs.Next(make([]driver.Value, 1)); err == nil || err == io.EOF {
+				t.Errorf("expected error, got %v", err)
+			}
+		})
+	}
+}
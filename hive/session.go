@@ -2,7 +2,9 @@ package hive
 
 import (
 	"context"
+	"time"
 
+	"github.com/bippio/go-impala/metrics"
 	"github.com/bippio/go-impala/services/cli_service"
 )
 
@@ -14,25 +16,88 @@ type Session struct {
 
 // Ping checks the connection
 func (s *Session) Ping(ctx context.Context) error {
+	info, err := s.GetInfo(ctx, cli_service.TGetInfoType_CLI_SERVER_NAME)
+	if err != nil {
+		return err
+	}
+
+	s.hive.log.DebugContext(ctx, "ping", "server", info.GetStringValue())
+	return nil
+}
+
+// GetInfo returns server information of given type
+func (s *Session) GetInfo(ctx context.Context, typ cli_service.TGetInfoType) (*cli_service.TGetInfoValue, error) {
 	req := cli_service.TGetInfoReq{
 		SessionHandle: s.h,
-		InfoType:      cli_service.TGetInfoType_CLI_SERVER_NAME,
+		InfoType:      typ,
 	}
 
 	resp, err := s.hive.client.GetInfo(ctx, &req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	return resp.InfoValue, nil
+}
+
+// GetDelegationToken obtains delegation token for owner, which renewer may
+// renew. Token is in string form accepted by sasl.ParseDelegationToken
+func (s *Session) GetDelegationToken(ctx context.Context, owner string, renewer string) (string, error) {
+	req := cli_service.TGetDelegationTokenReq{
+		SessionHandle: s.h,
+		Owner:         owner,
+		Renewer:       renewer,
+	}
+
+	resp, err := s.hive.client.GetDelegationToken(ctx, &req)
+	if err != nil {
+		return "", err
+	}
+	if err := checkStatus(resp); err != nil {
+		return "", err
+	}
+	return resp.GetDelegationToken(), nil
+}
+
+// RenewDelegationToken extends lifetime of delegation token
+func (s *Session) RenewDelegationToken(ctx context.Context, token string) error {
+	req := cli_service.TRenewDelegationTokenReq{
+		SessionHandle:   s.h,
+		DelegationToken: token,
+	}
+
+	resp, err := s.hive.client.RenewDelegationToken(ctx, &req)
+	if err != nil {
 		return err
 	}
+	return checkStatus(resp)
+}
 
-	s.hive.log.Printf("ping. server name: %s", resp.InfoValue.GetStringValue())
-	return nil
+// CancelDelegationToken invalidates delegation token
+func (s *Session) CancelDelegationToken(ctx context.Context, token string) error {
+	req := cli_service.TCancelDelegationTokenReq{
+		SessionHandle:   s.h,
+		DelegationToken: token,
+	}
+
+	resp, err := s.hive.client.CancelDelegationToken(ctx, &req)
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp)
 }
 
 // ExecuteStatement returns hive operation
-func (s *Session) ExecuteStatement(ctx context.Context, stmt string) (*Operation, error) {
+func (s *Session) ExecuteStatement(ctx context.Context, stmt string) (_ *Operation, err error) {
+	ctx, span := s.hive.startSpan(ctx, "hive.ExecuteStatement",
+		AttrSession.String(guid(s.h.GetSessionId().GUID)),
+		AttrDBStatement.String(NormalizeStatement(stmt)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
 	req := cli_service.TExecuteStatementReq{
 		SessionHandle: s.h,
 		Statement:     stmt,
@@ -40,20 +105,37 @@ func (s *Session) ExecuteStatement(ctx context.Context, stmt string) (*Operation
 	resp, err := s.hive.client.ExecuteStatement(ctx, &req)
 
 	if err != nil {
+		s.hive.metrics.StatementFinished(outcome(ctx, err))
 		return nil, err
 	}
 	if err := checkStatus(resp); err != nil {
+		s.hive.metrics.StatementFinished(outcome(ctx, err))
 		return nil, err
 	}
-	s.hive.log.Printf("execute operation: %s", guid(resp.OperationHandle.OperationId.GUID))
-	s.hive.log.Printf("operation. has resultset: %v", resp.OperationHandle.GetHasResultSet())
-	s.hive.log.Printf("operation. modified row count: %f", resp.OperationHandle.GetModifiedRowCount())
-	return &Operation{h: resp.OperationHandle, hive: s.hive}, nil
+	if resp.OperationHandle == nil || resp.OperationHandle.OperationId == nil {
+		s.hive.metrics.StatementFinished(metrics.OutcomeError)
+		return nil, errNoHandle
+	}
+	s.hive.metrics.ObserveLatency(metrics.PhaseExecute, time.Since(start))
+	s.hive.log.DebugContext(ctx, "execute operation",
+		"operation", guid(resp.OperationHandle.OperationId.GUID),
+		"has_resultset", resp.OperationHandle.GetHasResultSet(),
+		"modified_rows", resp.OperationHandle.GetModifiedRowCount(),
+	)
+	span.SetAttributes(
+		AttrOperation.String(guid(resp.OperationHandle.OperationId.GUID)),
+		AttrHasResultSet.Bool(resp.OperationHandle.GetHasResultSet()),
+		AttrModifiedRows.Float64(resp.OperationHandle.GetModifiedRowCount()),
+	)
+	return &Operation{h: resp.OperationHandle, hive: s.hive, session: s, start: start}, nil
 }
 
 // Close session
-func (s *Session) Close(ctx context.Context) error {
-	s.hive.log.Printf("close session: %v", guid(s.h.GetSessionId().GUID))
+func (s *Session) Close(ctx context.Context) (err error) {
+	ctx, span := s.hive.startSpan(ctx, "hive.CloseSession", AttrSession.String(guid(s.h.GetSessionId().GUID)))
+	defer func() { endSpan(span, err) }()
+
+	s.hive.log.DebugContext(ctx, "close session", "session", guid(s.h.GetSessionId().GUID))
 	req := cli_service.TCloseSessionReq{
 		SessionHandle: s.h,
 	}
@@ -64,5 +146,6 @@ func (s *Session) Close(ctx context.Context) error {
 	if err := checkStatus(resp); err != nil {
 		return err
 	}
+	s.hive.metrics.SessionClosed()
 	return nil
 }
@@ -0,0 +1,68 @@
+package hive
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/bippio/go-impala/hive"
+
+// Span attributes
+const (
+	AttrDBSystem     = attribute.Key("db.system")
+	AttrDBStatement  = attribute.Key("db.statement")
+	AttrSession      = attribute.Key("impala.session.id")
+	AttrOperation    = attribute.Key("impala.operation.id")
+	AttrHasResultSet = attribute.Key("impala.operation.has_resultset")
+	AttrModifiedRows = attribute.Key("impala.operation.modified_rows")
+	AttrRows         = attribute.Key("impala.fetch.rows")
+	AttrBatch        = attribute.Key("impala.fetch.batch")
+	AttrTotalRows    = attribute.Key("impala.operation.rows")
+	AttrTotalBatches = attribute.Key("impala.operation.batches")
+)
+
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// startSpan starts client span as a child of span in ctx, if any
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, AttrDBSystem.String("impala"))
+	return c.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+var (
+	stringLiteralRe  = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+	numberLiteralRe  = regexp.MustCompile(`\b\d+(?:\.\d+)?(?:[eE][-+]?\d+)?\b`)
+	whitespaceRe     = regexp.MustCompile(`\s+`)
+	normalizedMaxLen = 2048
+)
+
+// NormalizeStatement replaces literals with placeholders so that statement
+// can be recorded without sensitive values
+func NormalizeStatement(stmt string) string {
+	stmt = stringLiteralRe.ReplaceAllString(stmt, "?")
+	stmt = numberLiteralRe.ReplaceAllString(stmt, "?")
+	stmt = strings.TrimSpace(whitespaceRe.ReplaceAllString(stmt, " "))
+	if len(stmt) > normalizedMaxLen {
+		stmt = stmt[:normalizedMaxLen]
+	}
+	return stmt
+}
@@ -0,0 +1,23 @@
+package hive
+
+import (
+	"testing"
+)
+
+func TestNormalizeStatement(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: "select 1", out: "select ?"},
+		{in: "select * from t where name = 'O\\'Brien' and id = 42", out: "select * from t where name = ? and id = ?"},
+		{in: "select *\n  from t2\n where x = \"secret\" and y > 1.5e3", out: "select * from t2 where x = ? and y > ?"},
+		{in: "  show tables  ", out: "show tables"},
+	}
+
+	for _, tt := range tests {
+		if out := NormalizeStatement(tt.in); out != tt.out {
+			t.Errorf("NormalizeStatement(%q) = %q, want: %q", tt.in, out, tt.out)
+		}
+	}
+}
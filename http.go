@@ -0,0 +1,145 @@
+package impala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/metrics"
+)
+
+// errUnauthorized is returned when server rejects credentials of HTTP request
+var errUnauthorized = errors.New("server responded 401 Unauthorized")
+
+// dialHTTP creates transport of hs2-http protocol. Each flush is sent as HTTP
+// POST request authenticated according to auth mode
+func dialHTTP(ctx context.Context, opts *Options) (thrift.TTransport, error) {
+	scheme := "http"
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	dialer, err := newDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport.DialContext = dialer.DialContext
+	if opts.UseTLS {
+		cfg, err := tlsConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		scheme = "https"
+		transport.TLSClientConfig = cfg
+	}
+
+	auth := opts.auth()
+	rt := &authTransport{base: transport, auth: auth}
+	switch auth {
+	case AuthNoAuth, AuthNoSASL:
+	case AuthPlain, AuthLDAP:
+		so, err := saslOptions(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		rt.username, rt.password = so.Username, so.Password
+	case AuthJWT:
+		if opts.TokenProvider == nil {
+			return nil, errors.New("Please provide token provider for jwt auth")
+		}
+		token, err := opts.TokenProvider.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rt.provider = opts.TokenProvider
+		rt.token = token
+	default:
+		return nil, fmt.Errorf("auth %s is not supported with protocol %s", auth, ProtocolHiveServer2HTTP)
+	}
+
+	u := url.URL{Scheme: scheme, Host: net.JoinHostPort(opts.Host, opts.Port), Path: "/" + opts.HTTPPath}
+	t, err := thrift.NewTHttpClientWithOptions(u.String(), thrift.THttpClientOptions{Client: &http.Client{Transport: rt, Timeout: opts.SocketTimeout}})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.WrapTransport != nil {
+		t = opts.WrapTransport(t)
+	}
+	if opts.Metrics != nil {
+		t = metrics.NewTransport(t, opts.Metrics)
+	}
+	return t, nil
+}
+
+// authTransport adds authorization header to requests. Bearer token is
+// refreshed and request is sent again when server responds 401
+type authTransport struct {
+	base http.RoundTripper
+	auth string
+
+	username string
+	password string
+
+	provider TokenProvider
+	token    string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(t.authorize(req))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if t.provider == nil || req.GetBody == nil {
+		return nil, fmt.Errorf("impala: authentication failed (auth=%s): %w", t.auth, errUnauthorized)
+	}
+	token, err := t.provider.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	t.token = token
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	resp, err = t.base.RoundTrip(t.authorize(retry))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, fmt.Errorf("impala: authentication failed (auth=%s): %w", t.auth, errUnauthorized)
+	}
+	return resp, nil
+}
+
+// authorize returns copy of request with authorization header
+func (t *authTransport) authorize(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	switch {
+	case t.provider != nil:
+		r.Header.Set("Authorization", "Bearer "+t.token)
+	case t.username != "":
+		r.SetBasicAuth(t.username, t.password)
+	}
+	return r
+}
+
+// isUnauthorized reports whether server rejected credentials of HTTP request
+func isUnauthorized(err error) bool {
+	var te thrift.TTransportException
+	if errors.As(err, &te) && te.Err() != nil {
+		err = te.Err()
+	}
+	return errors.Is(err, errUnauthorized)
+}
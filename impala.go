@@ -1,9 +1,18 @@
 package impala
 
 import (
+	"crypto/tls"
 	"database/sql"
-	"io"
-	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/logging"
+	"github.com/bippio/go-impala/metrics"
+	"github.com/bippio/go-impala/sasl"
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func init() {
@@ -17,18 +26,143 @@ type Options struct {
 	Username string
 	Password string
 
+	// Database is default database of sessions, so that statements need
+	// not qualify table names
+	Database string
+
+	Protocol     string
+	Auth         string
 	UseLDAP      bool
 	UseTLS       bool
 	CACertPath   string
 	BufferSize   int
+	MaxFrameSize int
 	BatchSize    int
 	MemoryLimit  string
 	QueryTimeout int
 
-	LogOut io.Writer
+	// ConnectTimeout limits dialing, TLS handshake and SASL negotiation. Zero means no limit
+	ConnectTimeout time.Duration
+	// SocketTimeout limits every read and write of established connection. Zero means no limit
+	SocketTimeout time.Duration
+	// KeepAlive is period of TCP keepalive probes. Zero uses default of 15 seconds, negative disables them
+	KeepAlive time.Duration
+
+	// Proxy is URL of SOCKS5 or HTTP CONNECT proxy, e.g. "socks5://bastion:1080"
+	Proxy string
+	// ProxyFromEnvironment uses proxy of ALL_PROXY, except for hosts in NO_PROXY, when Proxy is empty
+	ProxyFromEnvironment bool
+	// Dialer opens connections instead of Proxy, e.g. to tunnel through SSH
+	Dialer Dialer
+
+	// KerberosService is service name of server principal. DefaultKerberosService if empty
+	KerberosService string
+	// KerberosCCache is path of credentials cache. KRB5CCNAME or default cache of kinit is used if empty
+	KerberosCCache string
+	// KerberosClient provides service tickets. Credentials cache is loaded if nil
+	KerberosClient *krb5.Client
+	// SASLQOP lists accepted qualities of protection in order of preference.
+	// The strongest offered by server is selected if empty
+	SASLQOP []sasl.QOP
+	// DelegationToken authenticates with DIGEST-MD5 in delegation-token auth mode
+	DelegationToken string
+	// CredentialProvider supplies username and password in plain and ldap
+	// auth modes instead of Username and Password
+	CredentialProvider CredentialProvider
+	// TokenProvider supplies bearer tokens in jwt auth mode
+	TokenProvider TokenProvider
+	// ImpersonateUser executes statements as user, if the connected user is
+	// authorized to impersonate. WithImpersonation overrides it per context
+	ImpersonateUser string
+	// HTTPPath is path of HiveServer2 endpoint with hs2-http protocol, e.g. "cliservice"
+	HTTPPath string
+
+	// ClientCertPath and ClientKeyPath enable mutual TLS
+	ClientCertPath        string
+	ClientKeyPath         string
+	TLSServerName         string
+	TLSMinVersion         string
+	TLSInsecureSkipVerify bool
+	// TLSConfig is used as base TLS configuration. Other TLS options override it
+	TLSConfig *tls.Config
+
+	// Logger receives driver logs. Sensitive attributes are redacted. Nil disables logging
+	Logger *slog.Logger
+	// TracerProvider for OpenTelemetry spans. Global provider is used if nil
+	TracerProvider trace.TracerProvider
+	// Metrics receives session, statement and fetch metrics. Nil disables metrics
+	Metrics metrics.Hook
+	// Interceptors wrap execution of every statement. The first interceptor is the outermost
+	Interceptors []Interceptor
+	// Retry policy for connecting and executing statements. Nil disables retries
+	Retry *RetryPolicy
+	// WrapClient wraps thrift client of every connection, e.g. to record calls
+	WrapClient func(thrift.TClient) thrift.TClient
+	// WrapTransport wraps socket of every connection below SASL and buffering,
+	// e.g. to inject faults in tests
+	WrapTransport func(thrift.TTransport) thrift.TTransport
 }
 
+// LogValue implements slog.LogValuer. Secrets are redacted
+func (o Options) LogValue() slog.Value {
+	password := ""
+	if o.Password != "" {
+		password = logging.Redacted
+	}
+	token := ""
+	if o.DelegationToken != "" {
+		token = logging.Redacted
+	}
+	proxy := o.Proxy
+	if u, err := url.Parse(proxy); err == nil {
+		proxy = u.Redacted()
+	}
+	return slog.GroupValue(
+		slog.String("host", o.Host),
+		slog.String("port", o.Port),
+		slog.String("username", o.Username),
+		slog.String("password", password),
+		slog.String("database", o.Database),
+		slog.String("protocol", o.Protocol),
+		slog.String("http_path", o.HTTPPath),
+		slog.String("auth", o.auth()),
+		slog.String("kerberos_service", o.KerberosService),
+		slog.String("impersonate_user", o.ImpersonateUser),
+		slog.String("delegation_token", token),
+		slog.Bool("tls", o.UseTLS),
+		slog.String("ca_cert", o.CACertPath),
+		slog.String("client_cert", o.ClientCertPath),
+		slog.String("tls_server_name", o.TLSServerName),
+		slog.String("tls_min_version", o.TLSMinVersion),
+		slog.Bool("tls_insecure_skip_verify", o.TLSInsecureSkipVerify),
+		slog.Int("buffer_size", o.BufferSize),
+		slog.Int("max_frame_size", o.MaxFrameSize),
+		slog.Int("batch_size", o.BatchSize),
+		slog.String("mem_limit", o.MemoryLimit),
+		slog.Int("query_timeout", o.QueryTimeout),
+		slog.Duration("connect_timeout", o.ConnectTimeout),
+		slog.Duration("socket_timeout", o.SocketTimeout),
+		slog.Duration("keepalive", o.KeepAlive),
+		slog.String("proxy", proxy),
+		slog.Bool("proxy_from_environment", o.ProxyFromEnvironment),
+	)
+}
+
+// Wire protocols supported by the driver
+const (
+	ProtocolHiveServer2     = "hs2"
+	ProtocolHiveServer2HTTP = "hs2-http"
+	ProtocolBeeswax         = "beeswax"
+)
+
+const (
+	// DefaultBeeswaxPort is used when protocol is beeswax and port is not set
+	DefaultBeeswaxPort = "21000"
+	// DefaultHTTPPort is used when protocol is hs2-http and port is not set
+	DefaultHTTPPort = "28000"
+)
+
 var (
 	// DefaultOptions for impala driver
-	DefaultOptions = Options{BatchSize: 1024, BufferSize: 4096, Port: "21050", LogOut: ioutil.Discard}
+	DefaultOptions = Options{BatchSize: 1024, BufferSize: 4096, Port: "21050", Protocol: ProtocolHiveServer2}
 )
@@ -0,0 +1,99 @@
+package impalatest
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// Faults injected into transport. Offsets count bytes read from or written
+// to the wrapped transport, and zero offsets disable the fault
+type Faults struct {
+	// Latency before each read and flush
+	Latency time.Duration
+	// ResetAfter bytes read, reads fail with connection reset and transport is closed
+	ResetAfter int64
+	// TruncateAfter bytes read, read stream ends with io.EOF
+	TruncateAfter int64
+	// WriteResetAfter bytes written, writes fail with connection reset and transport is closed
+	WriteResetAfter int64
+	// Corrupt maps offsets of read bytes to masks XORed with them
+	Corrupt map[int64]byte
+}
+
+// Wrap returns transport injecting faults into t. It can be used as Options.WrapTransport
+func (f Faults) Wrap(t thrift.TTransport) thrift.TTransport {
+	return &FaultTransport{TTransport: t, faults: f}
+}
+
+// FaultTransport injects faults into wrapped transport
+type FaultTransport struct {
+	thrift.TTransport
+	faults  Faults
+	read    int64
+	written int64
+}
+
+// BytesRead returns number of bytes read from wrapped transport
+func (t *FaultTransport) BytesRead() int64 {
+	return t.read
+}
+
+func reset(op string) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, syscall.ECONNRESET)}
+}
+
+func (t *FaultTransport) Read(buf []byte) (int, error) {
+	if t.faults.Latency > 0 {
+		time.Sleep(t.faults.Latency)
+	}
+
+	limit := int64(len(buf))
+	if f := t.faults.TruncateAfter; f > 0 {
+		if t.read >= f {
+			return 0, io.EOF
+		}
+		limit = min(limit, f-t.read)
+	}
+	if f := t.faults.ResetAfter; f > 0 {
+		if t.read >= f {
+			t.TTransport.Close()
+			return 0, reset("read")
+		}
+		limit = min(limit, f-t.read)
+	}
+
+	n, err := t.TTransport.Read(buf[:limit])
+	for i := 0; i < n; i++ {
+		if mask, ok := t.faults.Corrupt[t.read+int64(i)]; ok {
+			buf[i] ^= mask
+		}
+	}
+	t.read += int64(n)
+	return n, err
+}
+
+func (t *FaultTransport) Write(buf []byte) (int, error) {
+	if f := t.faults.WriteResetAfter; f > 0 && t.written+int64(len(buf)) > f {
+		n, _ := t.TTransport.Write(buf[:max(f-t.written, 0)])
+		t.written += int64(n)
+		t.TTransport.Close()
+		return n, reset("write")
+	}
+
+	n, err := t.TTransport.Write(buf)
+	t.written += int64(n)
+	return n, err
+}
+
+func (t *FaultTransport) Flush(ctx context.Context) error {
+	if t.faults.Latency > 0 {
+		time.Sleep(t.faults.Latency)
+	}
+	return t.TTransport.Flush(ctx)
+}
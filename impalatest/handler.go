@@ -0,0 +1,310 @@
+package impalatest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+var errNotSupported = errors.New("impalatest: not supported")
+
+type session struct {
+	username string
+	config   map[string]string
+}
+
+type operation struct {
+	session  string
+	res      *Result
+	offset   int
+	canceled bool
+}
+
+// handler implements cli_service.TCLIService
+type handler struct {
+	s *Server
+}
+
+func success() *cli_service.TStatus {
+	return &cli_service.TStatus{StatusCode: cli_service.TStatusCode_SUCCESS_STATUS}
+}
+
+func failure(err error) *cli_service.TStatus {
+	msg := err.Error()
+	return &cli_service.TStatus{StatusCode: cli_service.TStatusCode_ERROR_STATUS, ErrorMessage: &msg}
+}
+
+func invalidHandle() *cli_service.TStatus {
+	msg := "Invalid session id"
+	return &cli_service.TStatus{StatusCode: cli_service.TStatusCode_INVALID_HANDLE_STATUS, ErrorMessage: &msg}
+}
+
+// newHandle must be called with s.mu held
+func (s *Server) newHandle() *cli_service.THandleIdentifier {
+	s.nextID++
+	guid := make([]byte, 16)
+	binary.BigEndian.PutUint64(guid[8:], s.nextID)
+	return &cli_service.THandleIdentifier{GUID: guid, Secret: make([]byte, 16)}
+}
+
+func (s *Server) session(h *cli_service.TSessionHandle) (*session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h == nil || h.SessionId == nil {
+		return nil, false
+	}
+	sess, ok := s.sessions[string(h.SessionId.GUID)]
+	return sess, ok
+}
+
+func (s *Server) operation(h *cli_service.TOperationHandle) (*operation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h == nil || h.OperationId == nil {
+		return nil, false
+	}
+	op, ok := s.operations[string(h.OperationId.GUID)]
+	return op, ok
+}
+
+func (h *handler) OpenSession(ctx context.Context, req *cli_service.TOpenSessionReq) (*cli_service.TOpenSessionResp, error) {
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.newHandle()
+	s.sessions[string(id.GUID)] = &session{username: req.GetUsername(), config: req.Configuration}
+	return &cli_service.TOpenSessionResp{
+		Status:                success(),
+		ServerProtocolVersion: req.ClientProtocol,
+		SessionHandle:         &cli_service.TSessionHandle{SessionId: id},
+		Configuration:         req.Configuration,
+	}, nil
+}
+
+func (h *handler) CloseSession(ctx context.Context, req *cli_service.TCloseSessionReq) (*cli_service.TCloseSessionResp, error) {
+	s := h.s
+	if _, ok := s.session(req.SessionHandle); !ok {
+		return &cli_service.TCloseSessionResp{Status: invalidHandle()}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := string(req.SessionHandle.SessionId.GUID)
+	delete(s.sessions, id)
+	for k, op := range s.operations {
+		if op.session == id {
+			delete(s.operations, k)
+		}
+	}
+	return &cli_service.TCloseSessionResp{Status: success()}, nil
+}
+
+func (h *handler) GetInfo(ctx context.Context, req *cli_service.TGetInfoReq) (*cli_service.TGetInfoResp, error) {
+	if _, ok := h.s.session(req.SessionHandle); !ok {
+		// info value is required field of response
+		return &cli_service.TGetInfoResp{Status: invalidHandle(), InfoValue: &cli_service.TGetInfoValue{}}, nil
+	}
+
+	var value string
+	switch req.InfoType {
+	case cli_service.TGetInfoType_CLI_DBMS_NAME:
+		value = "Impala"
+	case cli_service.TGetInfoType_CLI_DBMS_VER:
+		value = h.s.opts.Version
+	case cli_service.TGetInfoType_CLI_SERVER_NAME:
+		value = "impalatest"
+	default:
+		return &cli_service.TGetInfoResp{Status: failure(errNotSupported), InfoValue: &cli_service.TGetInfoValue{}}, nil
+	}
+	return &cli_service.TGetInfoResp{
+		Status:    success(),
+		InfoValue: &cli_service.TGetInfoValue{StringValue: &value},
+	}, nil
+}
+
+func (h *handler) ExecuteStatement(ctx context.Context, req *cli_service.TExecuteStatementReq) (*cli_service.TExecuteStatementResp, error) {
+	s := h.s
+	if _, ok := s.session(req.SessionHandle); !ok {
+		return &cli_service.TExecuteStatementResp{Status: invalidHandle()}, nil
+	}
+
+	res, err := s.result(req.Statement)
+	if err != nil {
+		return &cli_service.TExecuteStatementResp{Status: failure(err)}, nil
+	}
+
+	if res.Delay > 0 {
+		select {
+		case <-time.After(res.Delay):
+		case <-s.done:
+		}
+	}
+
+	if res.Err != nil {
+		return &cli_service.TExecuteStatementResp{Status: failure(res.Err)}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newHandle()
+	s.operations[string(id.GUID)] = &operation{session: string(req.SessionHandle.SessionId.GUID), res: res}
+	return &cli_service.TExecuteStatementResp{
+		Status: success(),
+		OperationHandle: &cli_service.TOperationHandle{
+			OperationId:   id,
+			OperationType: cli_service.TOperationType_EXECUTE_STATEMENT,
+			HasResultSet:  len(res.Columns) > 0,
+		},
+	}, nil
+}
+
+func (h *handler) GetOperationStatus(ctx context.Context, req *cli_service.TGetOperationStatusReq) (*cli_service.TGetOperationStatusResp, error) {
+	op, ok := h.s.operation(req.OperationHandle)
+	if !ok {
+		return &cli_service.TGetOperationStatusResp{Status: invalidHandle()}, nil
+	}
+
+	state := cli_service.TOperationState_FINISHED_STATE
+	if op.canceled {
+		state = cli_service.TOperationState_CANCELED_STATE
+	}
+	return &cli_service.TGetOperationStatusResp{Status: success(), OperationState: &state}, nil
+}
+
+func (h *handler) CancelOperation(ctx context.Context, req *cli_service.TCancelOperationReq) (*cli_service.TCancelOperationResp, error) {
+	s := h.s
+	op, ok := s.operation(req.OperationHandle)
+	if !ok {
+		return &cli_service.TCancelOperationResp{Status: invalidHandle()}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op.canceled = true
+	return &cli_service.TCancelOperationResp{Status: success()}, nil
+}
+
+func (h *handler) CloseOperation(ctx context.Context, req *cli_service.TCloseOperationReq) (*cli_service.TCloseOperationResp, error) {
+	s := h.s
+	if _, ok := s.operation(req.OperationHandle); !ok {
+		return &cli_service.TCloseOperationResp{Status: invalidHandle()}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.operations, string(req.OperationHandle.OperationId.GUID))
+	return &cli_service.TCloseOperationResp{Status: success()}, nil
+}
+
+func (h *handler) GetResultSetMetadata(ctx context.Context, req *cli_service.TGetResultSetMetadataReq) (*cli_service.TGetResultSetMetadataResp, error) {
+	op, ok := h.s.operation(req.OperationHandle)
+	if !ok {
+		return &cli_service.TGetResultSetMetadataResp{Status: invalidHandle()}, nil
+	}
+
+	schema, err := op.res.schema()
+	if err != nil {
+		return &cli_service.TGetResultSetMetadataResp{Status: failure(err)}, nil
+	}
+	return &cli_service.TGetResultSetMetadataResp{Status: success(), Schema: schema}, nil
+}
+
+func (h *handler) FetchResults(ctx context.Context, req *cli_service.TFetchResultsReq) (*cli_service.TFetchResultsResp, error) {
+	s := h.s
+	op, ok := s.operation(req.OperationHandle)
+	if !ok {
+		return &cli_service.TFetchResultsResp{Status: invalidHandle()}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if op.canceled {
+		return &cli_service.TFetchResultsResp{Status: failure(errors.New("Cancelled"))}, nil
+	}
+
+	end := len(op.res.Rows)
+	if req.MaxRows > 0 && op.offset+int(req.MaxRows) < end {
+		end = op.offset + int(req.MaxRows)
+	}
+
+	rs, err := op.res.rowSet(op.offset, end)
+	if err != nil {
+		return &cli_service.TFetchResultsResp{Status: failure(err)}, nil
+	}
+	op.offset = end
+
+	more := op.offset < len(op.res.Rows)
+	return &cli_service.TFetchResultsResp{Status: success(), HasMoreRows: &more, Results: rs}, nil
+}
+
+func (h *handler) GetTypeInfo(ctx context.Context, req *cli_service.TGetTypeInfoReq) (*cli_service.TGetTypeInfoResp, error) {
+	return &cli_service.TGetTypeInfoResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetCatalogs(ctx context.Context, req *cli_service.TGetCatalogsReq) (*cli_service.TGetCatalogsResp, error) {
+	return &cli_service.TGetCatalogsResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetSchemas(ctx context.Context, req *cli_service.TGetSchemasReq) (*cli_service.TGetSchemasResp, error) {
+	return &cli_service.TGetSchemasResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetTables(ctx context.Context, req *cli_service.TGetTablesReq) (*cli_service.TGetTablesResp, error) {
+	return &cli_service.TGetTablesResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetTableTypes(ctx context.Context, req *cli_service.TGetTableTypesReq) (*cli_service.TGetTableTypesResp, error) {
+	return &cli_service.TGetTableTypesResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetColumns(ctx context.Context, req *cli_service.TGetColumnsReq) (*cli_service.TGetColumnsResp, error) {
+	return &cli_service.TGetColumnsResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetFunctions(ctx context.Context, req *cli_service.TGetFunctionsReq) (*cli_service.TGetFunctionsResp, error) {
+	return &cli_service.TGetFunctionsResp{Status: failure(errNotSupported)}, nil
+}
+
+func (h *handler) GetDelegationToken(ctx context.Context, req *cli_service.TGetDelegationTokenReq) (*cli_service.TGetDelegationTokenResp, error) {
+	if !h.s.sasl() {
+		return &cli_service.TGetDelegationTokenResp{Status: failure(errors.New("impalatest: delegation tokens require SASL authentication"))}, nil
+	}
+	if _, ok := h.s.session(req.SessionHandle); !ok {
+		return &cli_service.TGetDelegationTokenResp{Status: invalidHandle()}, nil
+	}
+
+	token, err := h.s.issueToken(req.Owner, req.Renewer)
+	if err != nil {
+		return &cli_service.TGetDelegationTokenResp{Status: failure(err)}, nil
+	}
+	return &cli_service.TGetDelegationTokenResp{Status: success(), DelegationToken: &token}, nil
+}
+
+func (h *handler) CancelDelegationToken(ctx context.Context, req *cli_service.TCancelDelegationTokenReq) (*cli_service.TCancelDelegationTokenResp, error) {
+	if _, ok := h.s.session(req.SessionHandle); !ok {
+		return &cli_service.TCancelDelegationTokenResp{Status: invalidHandle()}, nil
+	}
+	if err := h.s.cancelToken(req.DelegationToken); err != nil {
+		return &cli_service.TCancelDelegationTokenResp{Status: failure(err)}, nil
+	}
+	return &cli_service.TCancelDelegationTokenResp{Status: success()}, nil
+}
+
+func (h *handler) RenewDelegationToken(ctx context.Context, req *cli_service.TRenewDelegationTokenReq) (*cli_service.TRenewDelegationTokenResp, error) {
+	if _, ok := h.s.session(req.SessionHandle); !ok {
+		return &cli_service.TRenewDelegationTokenResp{Status: invalidHandle()}, nil
+	}
+	if _, err := h.s.tokenPassword(req.DelegationToken); err != nil {
+		return &cli_service.TRenewDelegationTokenResp{Status: failure(err)}, nil
+	}
+	return &cli_service.TRenewDelegationTokenResp{Status: success()}, nil
+}
+
+func (h *handler) GetLog(ctx context.Context, req *cli_service.TGetLogReq) (*cli_service.TGetLogResp, error) {
+	return &cli_service.TGetLogResp{Status: failure(errNotSupported)}, nil
+}
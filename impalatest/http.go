@@ -0,0 +1,54 @@
+package impalatest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+// SetBearerToken changes token accepted by server with HTTP, e.g. to
+// simulate rotation of signing keys
+func (s *Server) SetBearerToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.BearerToken = token
+}
+
+// newHTTPServer answers thrift requests sent as HTTP POST, as impala daemon
+// does on hs2_http_port
+func (s *Server) newHTTPServer() *http.Server {
+	protocol := thrift.NewTBinaryProtocolFactory(true, true)
+	handle := thrift.NewThriftHandlerFunc(cli_service.NewTCLIServiceProcessor(&handler{s: s}), protocol, protocol)
+	return &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handle(w, r)
+	})}
+}
+
+// authorized checks bearer token or basic credentials of request
+func (s *Server) authorized(r *http.Request) bool {
+	s.mu.Lock()
+	token := s.opts.BearerToken
+	s.mu.Unlock()
+
+	if token != "" {
+		return r.Header.Get("Authorization") == "Bearer "+token
+	}
+	if s.opts.Username != "" {
+		username, password, ok := r.BasicAuth()
+		return ok && username == s.opts.Username && password == s.opts.Password
+	}
+	if s.opts.SASL {
+		return strings.HasPrefix(r.Header.Get("Authorization"), "Basic ")
+	}
+	return true
+}
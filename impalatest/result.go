@@ -0,0 +1,187 @@
+package impalatest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+func typeID(name string) (cli_service.TTypeId, error) {
+	id, err := cli_service.TTypeIdFromString(strings.ToUpper(name) + "_TYPE")
+	if err != nil {
+		return 0, fmt.Errorf("impalatest: type %s not recognized", name)
+	}
+	return id, nil
+}
+
+func (r *Result) schema() (*cli_service.TTableSchema, error) {
+	schema := &cli_service.TTableSchema{}
+	for i, col := range r.Columns {
+		id, err := typeID(col.Type)
+		if err != nil {
+			return nil, err
+		}
+		schema.Columns = append(schema.Columns, &cli_service.TColumnDesc{
+			ColumnName: col.Name,
+			TypeDesc: &cli_service.TTypeDesc{
+				Types: []*cli_service.TTypeEntry{{PrimitiveEntry: &cli_service.TPrimitiveTypeEntry{Type: id}}},
+			},
+			Position: int32(i + 1),
+		})
+	}
+	return schema, nil
+}
+
+// rowSet encodes rows from start to end in columnar format
+func (r *Result) rowSet(start, end int) (*cli_service.TRowSet, error) {
+	rows := r.Rows[start:end]
+	rs := &cli_service.TRowSet{StartRowOffset: int64(start)}
+	for i, col := range r.Columns {
+		c, err := column(col, rows, i)
+		if err != nil {
+			return nil, err
+		}
+		rs.Columns = append(rs.Columns, c)
+	}
+	return rs, nil
+}
+
+func column(col Column, rows [][]interface{}, idx int) (*cli_service.TColumn, error) {
+	id, err := typeID(col.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(rows)
+	nulls := make([]byte, (n+7)/8)
+	values := make([]interface{}, n)
+	for i, row := range rows {
+		if len(row) <= idx {
+			return nil, fmt.Errorf("impalatest: row %d has no value for column %s", i, col.Name)
+		}
+		if row[idx] == nil {
+			nulls[i/8] |= 1 << (uint(i) % 8)
+		}
+		values[i] = row[idx]
+	}
+
+	c := &cli_service.TColumn{}
+	switch id {
+	case cli_service.TTypeId_BOOLEAN_TYPE:
+		c.BoolVal = &cli_service.TBoolColumn{Values: make([]bool, n), Nulls: nulls}
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, mismatch(col, v)
+			}
+			c.BoolVal.Values[i] = b
+		}
+	case cli_service.TTypeId_TINYINT_TYPE, cli_service.TTypeId_SMALLINT_TYPE,
+		cli_service.TTypeId_INT_TYPE, cli_service.TTypeId_BIGINT_TYPE:
+		ints := make([]int64, n)
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			x, ok := toInt64(v)
+			if !ok {
+				return nil, mismatch(col, v)
+			}
+			ints[i] = x
+		}
+		setInts(c, id, ints, nulls)
+	case cli_service.TTypeId_FLOAT_TYPE, cli_service.TTypeId_DOUBLE_TYPE:
+		c.DoubleVal = &cli_service.TDoubleColumn{Values: make([]float64, n), Nulls: nulls}
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			x, ok := toFloat64(v)
+			if !ok {
+				return nil, mismatch(col, v)
+			}
+			c.DoubleVal.Values[i] = x
+		}
+	default:
+		c.StringVal = &cli_service.TStringColumn{Values: make([]string, n), Nulls: nulls}
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			c.StringVal.Values[i] = toString(id, v)
+		}
+	}
+	return c, nil
+}
+
+func setInts(c *cli_service.TColumn, id cli_service.TTypeId, ints []int64, nulls []byte) {
+	switch id {
+	case cli_service.TTypeId_TINYINT_TYPE:
+		c.ByteVal = &cli_service.TByteColumn{Nulls: nulls}
+		for _, x := range ints {
+			c.ByteVal.Values = append(c.ByteVal.Values, int8(x))
+		}
+	case cli_service.TTypeId_SMALLINT_TYPE:
+		c.I16Val = &cli_service.TI16Column{Nulls: nulls}
+		for _, x := range ints {
+			c.I16Val.Values = append(c.I16Val.Values, int16(x))
+		}
+	case cli_service.TTypeId_INT_TYPE:
+		c.I32Val = &cli_service.TI32Column{Nulls: nulls}
+		for _, x := range ints {
+			c.I32Val.Values = append(c.I32Val.Values, int32(x))
+		}
+	default:
+		c.I64Val = &cli_service.TI64Column{Values: ints, Nulls: nulls}
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	if x, ok := toInt64(v); ok {
+		return float64(x), true
+	}
+	return 0, false
+}
+
+func toString(id cli_service.TTypeId, v interface{}) string {
+	t, ok := v.(time.Time)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if id == cli_service.TTypeId_DATE_TYPE {
+		return t.Format(hive.DateFormat)
+	}
+	return t.Format(hive.TimestampFormat)
+}
+
+func mismatch(col Column, v interface{}) error {
+	return fmt.Errorf("impalatest: value %v of type %T does not match column %s %s", v, v, col.Name, col.Type)
+}
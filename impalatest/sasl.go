@@ -0,0 +1,185 @@
+package impalatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/sasl"
+)
+
+// saslTransport is server side of SASL transport. Messages are framed
+// with 4 byte length after negotiation
+type saslTransport struct {
+	thrift.TTransport
+	rbuf bytes.Buffer
+	wbuf bytes.Buffer
+}
+
+// saslHandshake authenticates client with PLAIN mechanism, or DIGEST-MD5
+// with delegation token issued by server. Any credentials are accepted by
+// PLAIN if username is empty
+func (s *Server) saslHandshake(t thrift.TTransport) (*saslTransport, error) {
+	status, mech, err := readMessage(t)
+	if err != nil {
+		return nil, err
+	}
+	if status != sasl.StatusStart || string(mech) != sasl.MechPlain && string(mech) != sasl.MechDigestMD5 {
+		writeMessage(t, sasl.StatusBad, []byte("unsupported mechanism"))
+		return nil, fmt.Errorf("impalatest: unsupported sasl mechanism %q", mech)
+	}
+
+	status, payload, err := readMessage(t)
+	if err != nil {
+		return nil, err
+	}
+	if status != sasl.StatusOK {
+		writeMessage(t, sasl.StatusBad, []byte("authentication failed"))
+		return nil, errors.New("impalatest: authentication failed")
+	}
+
+	var final []byte
+	if string(mech) == sasl.MechDigestMD5 {
+		final, err = s.digestHandshake(t)
+	} else {
+		err = s.plain(payload)
+	}
+	if err != nil {
+		writeMessage(t, sasl.StatusBad, []byte("authentication failed"))
+		return nil, err
+	}
+
+	if err := writeMessage(t, sasl.StatusComplete, final); err != nil {
+		return nil, err
+	}
+	return &saslTransport{TTransport: t}, nil
+}
+
+// plain checks credentials of PLAIN message: authzid NUL authcid NUL passwd
+func (s *Server) plain(payload []byte) error {
+	parts := bytes.Split(payload, []byte{0})
+	if len(parts) != 3 || s.opts.Username != "" && (string(parts[1]) != s.opts.Username || string(parts[2]) != s.opts.Password) {
+		return errors.New("impalatest: authentication failed")
+	}
+	return nil
+}
+
+// digestHandshake challenges client as HiveServer2 does with DIGEST-MD5 of
+// java and returns rspauth. Only auth qop is offered
+func (s *Server) digestHandshake(t thrift.TTransport) ([]byte, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	nonce := base64.StdEncoding.EncodeToString(b)
+	challenge := fmt.Sprintf(`realm="default",nonce="%s",qop="auth",charset=utf-8,algorithm=md5-sess`, nonce)
+	if err := writeMessage(t, sasl.StatusOK, []byte(challenge)); err != nil {
+		return nil, err
+	}
+
+	status, payload, err := readMessage(t)
+	if err != nil {
+		return nil, err
+	}
+	// values of driver contain no commas
+	directives := map[string]string{}
+	for _, d := range strings.Split(string(payload), ",") {
+		if name, value, ok := strings.Cut(d, "="); ok {
+			directives[name] = strings.Trim(value, `"`)
+		}
+	}
+	if status != sasl.StatusOK || directives["nonce"] != nonce || directives["qop"] != "auth" || directives["digest-uri"] != "null/default" {
+		return nil, errors.New("impalatest: invalid digest response")
+	}
+
+	identifier, err := base64.StdEncoding.DecodeString(directives["username"])
+	if err != nil {
+		return nil, err
+	}
+	password, err := s.identifierPassword(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	h := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return string(sum[:])
+	}
+	hexh := func(s string) string { return hex.EncodeToString([]byte(h(s))) }
+	secret := h(directives["username"] + ":" + directives["realm"] + ":" + base64.StdEncoding.EncodeToString(password))
+	ha1 := hex.EncodeToString([]byte(h(secret + ":" + nonce + ":" + directives["cnonce"])))
+	digest := func(a2 string) string {
+		return hexh(ha1 + ":" + nonce + ":" + directives["nc"] + ":" + directives["cnonce"] + ":auth:" + hexh(a2))
+	}
+
+	if directives["response"] != digest("AUTHENTICATE:null/default") {
+		return nil, errors.New("impalatest: digest authentication failed")
+	}
+	return []byte("rspauth=" + digest(":null/default")), nil
+}
+
+func readMessage(t io.Reader) (sasl.Status, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(t, header); err != nil {
+		return 0, nil, err
+	}
+	// e.g. thrift message of client without SASL
+	if status := sasl.Status(header[0]); status < sasl.StatusStart || status > sasl.StatusComplete {
+		return 0, nil, fmt.Errorf("impalatest: invalid sasl status %d", status)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(t, body); err != nil {
+		return 0, nil, err
+	}
+	return sasl.Status(header[0]), body, nil
+}
+
+func writeMessage(t thrift.TTransport, status sasl.Status, body []byte) error {
+	msg := make([]byte, 5, 5+len(body))
+	msg[0] = byte(status)
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(body)))
+	if _, err := t.Write(append(msg, body...)); err != nil {
+		return err
+	}
+	return t.Flush(context.Background())
+}
+
+func (t *saslTransport) Read(buf []byte) (int, error) {
+	if t.rbuf.Len() == 0 {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(t.TTransport, header); err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(&t.rbuf, t.TTransport, int64(binary.BigEndian.Uint32(header))); err != nil {
+			return 0, err
+		}
+	}
+	return t.rbuf.Read(buf)
+}
+
+func (t *saslTransport) Write(buf []byte) (int, error) {
+	return t.wbuf.Write(buf)
+}
+
+func (t *saslTransport) Flush(ctx context.Context) error {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(t.wbuf.Len()))
+	if _, err := t.TTransport.Write(append(header, t.wbuf.Bytes()...)); err != nil {
+		return err
+	}
+	t.wbuf.Reset()
+	return t.TTransport.Flush(ctx)
+}
+
+func (t *saslTransport) RemainingBytes() uint64 {
+	return uint64(t.rbuf.Len())
+}
@@ -0,0 +1,329 @@
+// Package impalatest provides in-process HiveServer2 server for tests.
+//
+// Server answers TCLIService requests over thrift binary protocol with
+// scripted schemas, rows and errors. It optionally requires SASL PLAIN
+// authentication and TLS, so that tests can exercise the driver the same
+// way as against impala daemon. With HTTP it serves hs2-http protocol
+// with basic or bearer token authentication.
+package impalatest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+// DefaultVersion reported by server
+const DefaultVersion = "impalad version 3.4.0-RELEASE (build impalatest)"
+
+// Options for test server
+type Options struct {
+	// Username and Password enable SASL PLAIN authentication
+	Username string
+	Password string
+	// SASL enables SASL PLAIN authentication which accepts any credentials,
+	// as HiveServer2 with NONE authentication. It is implied by Username.
+	// Delegation tokens issued by server are accepted with DIGEST-MD5
+	SASL bool
+	// TLS enables TLS with self-signed certificate for 127.0.0.1
+	TLS bool
+	// HTTP serves hs2-http protocol. Username and Password are checked as
+	// basic credentials
+	HTTP bool
+	// BearerToken is required as JWT of requests with HTTP
+	BearerToken string
+	// Version reported as CLI_DBMS_VER. DefaultVersion if empty
+	Version string
+}
+
+// Column of scripted result set
+type Column struct {
+	Name string
+	// Type is impala type name such as "INT", "STRING" or "TIMESTAMP"
+	Type string
+}
+
+// Result scripted for statement
+type Result struct {
+	Columns []Column
+	// Rows of values. Supported values are nil, bool, integers, floats,
+	// strings and time.Time for TIMESTAMP and DATE columns
+	Rows [][]interface{}
+	// Err is returned as error status by ExecuteStatement
+	Err error
+	// Delay before ExecuteStatement responds, to simulate slow operations
+	Delay time.Duration
+}
+
+// HandlerFunc returns result for statement. Nil result is reported as unexpected statement
+type HandlerFunc func(stmt string) *Result
+
+// Server is in-process HiveServer2 server
+type Server struct {
+	// Addr is host:port server listens on
+	Addr string
+
+	opts     Options
+	listener net.Listener
+	cert     *x509.Certificate
+	done     chan struct{}
+	wg       sync.WaitGroup
+	http     *http.Server
+
+	mu         sync.Mutex
+	conns      map[net.Conn]struct{}
+	results    map[string]*Result
+	fallback   HandlerFunc
+	statements []string
+	sessions   map[string]*session
+	operations map[string]*operation
+	// tokens maps identifiers of issued delegation tokens to passwords
+	tokens map[string][]byte
+	nextID uint64
+}
+
+// NewServer starts server listening on random port of 127.0.0.1
+func NewServer(opts Options) (*Server, error) {
+	if opts.Version == "" {
+		opts.Version = DefaultVersion
+	}
+
+	s := &Server{
+		opts:       opts,
+		done:       make(chan struct{}),
+		conns:      make(map[net.Conn]struct{}),
+		results:    make(map[string]*Result),
+		sessions:   make(map[string]*session),
+		operations: make(map[string]*operation),
+		tokens:     make(map[string][]byte),
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TLS {
+		cert, err := selfSignedCert()
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		s.cert = cert.Leaf
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	s.listener = l
+	s.Addr = l.Addr().String()
+
+	s.wg.Add(1)
+	if opts.HTTP {
+		s.http = s.newHTTPServer()
+		go func() {
+			defer s.wg.Done()
+			s.http.Serve(l)
+		}()
+	} else {
+		go s.serve()
+	}
+	return s, nil
+}
+
+// Host returns host server listens on
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns port server listens on
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	return port
+}
+
+// DSN returns data source name for the driver. Certificate is not verified when TLS is enabled
+func (s *Server) DSN() string {
+	u := url.URL{Scheme: "impala", Host: s.Addr}
+	query := url.Values{}
+	if s.opts.Username != "" {
+		u.User = url.UserPassword(s.opts.Username, s.opts.Password)
+		query.Set("auth", "ldap")
+	} else if s.opts.SASL {
+		query.Set("auth", "plain")
+	}
+	if s.opts.HTTP {
+		query.Set("protocol", "hs2-http")
+		if s.opts.BearerToken != "" {
+			query.Set("auth", "jwt")
+			query.Set("jwt", s.opts.BearerToken)
+		}
+	}
+	if s.opts.TLS {
+		query.Set("tls", "true")
+		query.Set("tls-insecure-skip-verify", "true")
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Certificate returns server certificate, or nil if TLS is disabled
+func (s *Server) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Handle scripts result for statement
+func (s *Server) Handle(stmt string, res *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[stmt] = res
+}
+
+// HandleFunc sets handler for statements without scripted result
+func (s *Server) HandleFunc(fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = fn
+}
+
+// Session opened by client
+type Session struct {
+	Username      string
+	Configuration map[string]string
+}
+
+// Sessions returns open sessions in order of opening
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	// handle identifiers are increasing big endian numbers
+	sort.Strings(ids)
+
+	sessions := make([]Session, 0, len(ids))
+	for _, id := range ids {
+		sessions = append(sessions, Session{Username: s.sessions[id].username, Configuration: s.sessions[id].config})
+	}
+	return sessions
+}
+
+// Statements returns executed statements
+func (s *Server) Statements() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.statements...)
+}
+
+// ResetSessions forgets all sessions and operations, like coordinator restart.
+// Connections are kept open, subsequent requests fail with invalid handle
+func (s *Server) ResetSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]*session)
+	s.operations = make(map[string]*operation)
+}
+
+// Close stops server and closes client connections
+func (s *Server) Close() error {
+	close(s.done)
+	err := s.listener.Close()
+	if s.http != nil {
+		s.http.Close()
+	}
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) result(stmt string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, stmt)
+
+	res, ok := s.results[stmt]
+	if !ok && s.fallback != nil {
+		res = s.fallback(stmt)
+	}
+	if res == nil {
+		return nil, fmt.Errorf("impalatest: unexpected statement: %s", stmt)
+	}
+	return res, nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		select {
+		case <-s.done:
+			s.mu.Unlock()
+			c.Close()
+			return
+		default:
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c)
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer c.Close()
+
+	socket := thrift.NewTSocketFromConnTimeout(c, 0)
+
+	var transport thrift.TTransport
+	if s.sasl() {
+		t, err := s.saslHandshake(socket)
+		if err != nil {
+			return
+		}
+		transport = t
+	} else {
+		transport = thrift.NewTBufferedTransport(socket, 4096)
+	}
+
+	// driver writes strict headers. Strict read rejects SASL messages of
+	// clients with wrong auth mode instead of waiting for huge message name
+	protocol := thrift.NewTBinaryProtocol(transport, true, true)
+	processor := cli_service.NewTCLIServiceProcessor(&handler{s: s})
+	for {
+		ok, err := processor.Process(context.Background(), protocol, protocol)
+		if err != nil || !ok {
+			return
+		}
+	}
+}
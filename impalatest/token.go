@@ -0,0 +1,73 @@
+package impalatest
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/bippio/go-impala/sasl"
+)
+
+// tokenKind of delegation tokens issued by HiveServer2
+const tokenKind = "HIVE_DELEGATION_TOKEN"
+
+var errTokenNotFound = errors.New("impalatest: delegation token not found")
+
+// sasl reports whether server requires SASL authentication
+func (s *Server) sasl() bool {
+	return s.opts.Username != "" || s.opts.SASL
+}
+
+// issueToken creates delegation token of owner
+func (s *Server) issueToken(owner, renewer string) (string, error) {
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	token := &sasl.DelegationToken{
+		Identifier: []byte(fmt.Sprintf("%s:%s:%d", owner, renewer, s.nextID)),
+		Password:   password,
+		Kind:       tokenKind,
+	}
+	s.tokens[string(token.Identifier)] = password
+	return token.String(), nil
+}
+
+// tokenPassword returns password of issued token in string form
+func (s *Server) tokenPassword(str string) ([]byte, error) {
+	token, err := sasl.ParseDelegationToken(str)
+	if err != nil {
+		return nil, err
+	}
+	return s.identifierPassword(token.Identifier)
+}
+
+// identifierPassword returns password of issued token with identifier
+func (s *Server) identifierPassword(identifier []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	password, ok := s.tokens[string(identifier)]
+	if !ok {
+		return nil, errTokenNotFound
+	}
+	return password, nil
+}
+
+func (s *Server) cancelToken(str string) error {
+	token, err := sasl.ParseDelegationToken(str)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[string(token.Identifier)]; !ok {
+		return errTokenNotFound
+	}
+	delete(s.tokens, string(token.Identifier))
+	return nil
+}
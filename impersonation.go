@@ -0,0 +1,25 @@
+package impala
+
+import (
+	"context"
+	"errors"
+)
+
+// errImpersonationNotSupported is returned by beeswax connections, which
+// have no session configuration
+var errImpersonationNotSupported = errors.New("impala: impersonation is not supported with protocol beeswax")
+
+type impersonationKey struct{}
+
+// WithImpersonation returns context whose statements are executed as user.
+// It overrides Options.ImpersonateUser. Connection opens separate session
+// for each user, and closes them when it is returned to the pool
+func WithImpersonation(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, impersonationKey{}, user)
+}
+
+// impersonation returns user set by WithImpersonation
+func impersonation(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(impersonationKey{}).(string)
+	return user, ok
+}
@@ -0,0 +1,58 @@
+package impala
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// QueryFunc executes statement that may return rows
+type QueryFunc func(ctx context.Context, stmt string, args []driver.NamedValue) (driver.Rows, error)
+
+// ExecFunc executes statement that doesn't return rows
+type ExecFunc func(ctx context.Context, stmt string, args []driver.NamedValue) (driver.Result, error)
+
+// Interceptor wraps statement execution. It receives the final statement text
+// with args already interpolated, and may rewrite the statement, reject it by
+// returning an error without calling next, or inspect the result of next.
+// Args are passed for inspection only
+type Interceptor interface {
+	Query(ctx context.Context, stmt string, args []driver.NamedValue, next QueryFunc) (driver.Rows, error)
+	Exec(ctx context.Context, stmt string, args []driver.NamedValue, next ExecFunc) (driver.Result, error)
+}
+
+// interceptors is chain of interceptors. The first interceptor is the outermost
+type interceptors []Interceptor
+
+func (ch interceptors) query(ctx context.Context, stmt string, args []driver.NamedValue, final QueryFunc) (driver.Rows, error) {
+	if len(ch) == 0 {
+		return final(ctx, stmt, args)
+	}
+	next := func(ctx context.Context, stmt string, args []driver.NamedValue) (driver.Rows, error) {
+		return ch[1:].query(ctx, stmt, args, final)
+	}
+	return ch[0].Query(ctx, stmt, args, next)
+}
+
+func (ch interceptors) exec(ctx context.Context, stmt string, args []driver.NamedValue, final ExecFunc) (driver.Result, error) {
+	if len(ch) == 0 {
+		return final(ctx, stmt, args)
+	}
+	next := func(ctx context.Context, stmt string, args []driver.NamedValue) (driver.Result, error) {
+		return ch[1:].exec(ctx, stmt, args, final)
+	}
+	return ch[0].Exec(ctx, stmt, args, next)
+}
+
+// runQuery passes statement through interceptors to connection
+func runQuery(ctx context.Context, c conn, ch interceptors, stmt string, args []driver.NamedValue) (driver.Rows, error) {
+	return ch.query(ctx, stmt, args, func(ctx context.Context, stmt string, _ []driver.NamedValue) (driver.Rows, error) {
+		return c.query(ctx, stmt)
+	})
+}
+
+// runExec passes statement through interceptors to connection
+func runExec(ctx context.Context, c conn, ch interceptors, stmt string, args []driver.NamedValue) (driver.Result, error) {
+	return ch.exec(ctx, stmt, args, func(ctx context.Context, stmt string, _ []driver.NamedValue) (driver.Result, error) {
+		return c.exec(ctx, stmt)
+	})
+}
@@ -0,0 +1,101 @@
+package impala
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeConn struct {
+	driver.Conn
+	stmts []string
+}
+
+func (c *fakeConn) query(ctx context.Context, stmt string) (driver.Rows, error) {
+	c.stmts = append(c.stmts, stmt)
+	return nil, nil
+}
+
+func (c *fakeConn) exec(ctx context.Context, stmt string) (driver.Result, error) {
+	c.stmts = append(c.stmts, stmt)
+	return driver.RowsAffected(1), nil
+}
+
+type tagInterceptor struct {
+	tag   string
+	calls *[]string
+}
+
+func (i tagInterceptor) Query(ctx context.Context, stmt string, args []driver.NamedValue, next QueryFunc) (driver.Rows, error) {
+	*i.calls = append(*i.calls, i.tag)
+	return next(ctx, stmt+" /* "+i.tag+" */", args)
+}
+
+func (i tagInterceptor) Exec(ctx context.Context, stmt string, args []driver.NamedValue, next ExecFunc) (driver.Result, error) {
+	*i.calls = append(*i.calls, i.tag)
+	return next(ctx, stmt+" /* "+i.tag+" */", args)
+}
+
+var errReadOnly = errors.New("read-only")
+
+type readOnlyInterceptor struct{}
+
+func (readOnlyInterceptor) Query(ctx context.Context, stmt string, args []driver.NamedValue, next QueryFunc) (driver.Rows, error) {
+	return next(ctx, stmt, args)
+}
+
+func (readOnlyInterceptor) Exec(ctx context.Context, stmt string, args []driver.NamedValue, next ExecFunc) (driver.Result, error) {
+	if strings.HasPrefix(strings.ToUpper(stmt), "INSERT") {
+		return nil, errReadOnly
+	}
+	return next(ctx, stmt, args)
+}
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+	ch := interceptors{
+		tagInterceptor{tag: "a", calls: &calls},
+		tagInterceptor{tag: "b", calls: &calls},
+		readOnlyInterceptor{},
+	}
+	c := &fakeConn{}
+	args := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}
+
+	if _, err := runQuery(context.Background(), c, ch, "SELECT 1", args); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SELECT 1 /* a */ /* b */"; len(c.stmts) != 1 || c.stmts[0] != expected {
+		t.Errorf("statements = %q, want %q", c.stmts, expected)
+	}
+	if strings.Join(calls, ",") != "a,b" {
+		t.Errorf("calls = %v, want outermost first", calls)
+	}
+
+	res, err := runExec(context.Background(), c, ch, "CREATE TABLE t (i int)", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("rows affected = %d, want 1", n)
+	}
+
+	_, err = runExec(context.Background(), c, ch, "INSERT INTO t VALUES (1)", args)
+	if !errors.Is(err, errReadOnly) {
+		t.Errorf("err = %v, want %v", err, errReadOnly)
+	}
+	if len(c.stmts) != 2 {
+		t.Errorf("blocked statement reached connection: %q", c.stmts)
+	}
+}
+
+func TestNoInterceptors(t *testing.T) {
+	c := &fakeConn{}
+	if _, err := runQuery(context.Background(), c, nil, "SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.stmts) != 1 || c.stmts[0] != "SELECT 1" {
+		t.Errorf("statements = %q", c.stmts)
+	}
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LevelTrace is more verbose than debug. It is used for dumps of fetched results
+const LevelTrace = slog.Level(-8)
+
+// Redacted replaces values of sensitive attributes
+const Redacted = "REDACTED"
+
+var sensitive = []string{"password", "passwd", "secret", "token", "credential", "authorization"}
+
+var (
+	// Discard is logger which drops all records
+	Discard = slog.New(discardHandler{})
+)
+
+// IsSensitive returns whether attribute with given key must be redacted
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitive {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns logger which redacts sensitive attributes before passing records to l.
+// Nil logger drops all records
+func New(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return Discard
+	}
+	if _, ok := l.Handler().(*redactHandler); ok {
+		return l
+	}
+	return slog.New(NewRedactingHandler(l.Handler()))
+}
+
+// ParseLevel parses level name: trace, debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	if strings.EqualFold(s, "trace") {
+		return LevelTrace, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("log level %s not recognized", s)
+	}
+	return l, nil
+}
+
+// NewRedactingHandler wraps handler so that values of sensitive attributes are redacted
+func NewRedactingHandler(h slog.Handler) slog.Handler {
+	return &redactHandler{h: h}
+}
+
+type redactHandler struct {
+	h slog.Handler
+}
+
+func (r *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.h.Enabled(ctx, level)
+}
+
+func (r *redactHandler) Handle(ctx context.Context, rec slog.Record) error {
+	nr := slog.NewRecord(rec.Time, rec.Level, rec.Message, rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(redact(a))
+		return true
+	})
+	return r.h.Handle(ctx, nr)
+}
+
+func (r *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redact(a)
+	}
+	return &redactHandler{h: r.h.WithAttrs(redacted)}
+}
+
+func (r *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{h: r.h.WithGroup(name)}
+}
+
+func redact(a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+
+	group := v.Group()
+	attrs := make([]slog.Attr, len(group))
+	for i, ga := range group {
+		attrs[i] = redact(ga)
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
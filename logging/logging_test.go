@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace})))
+
+	logger.With("ldap_password", "p@ssw0rd").Info("connect",
+		"user", "admin",
+		slog.Group("opts", "host", "localhost", "Password", "s3cret"),
+		"token", "abc",
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"p@ssw0rd", "s3cret", "abc"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q is logged: %s", secret, out)
+		}
+	}
+	for _, visible := range []string{"user=admin", "opts.host=localhost", "opts.Password=REDACTED"} {
+		if !strings.Contains(out, visible) {
+			t.Errorf("%q is missing: %s", visible, out)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in  string
+		out slog.Level
+	}{
+		{in: "trace", out: LevelTrace},
+		{in: "debug", out: slog.LevelDebug},
+		{in: "INFO", out: slog.LevelInfo},
+		{in: "warn", out: slog.LevelWarn},
+		{in: "error", out: slog.LevelError},
+	}
+
+	for _, tt := range tests {
+		l, err := ParseLevel(tt.in)
+		if err != nil {
+			t.Errorf("ParseLevel(%q): %v", tt.in, err)
+			continue
+		}
+		if l != tt.out {
+			t.Errorf("ParseLevel(%q) = %v, want: %v", tt.in, l, tt.out)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	if New(nil) != Discard {
+		t.Error("nil logger must be replaced with Discard")
+	}
+	if Discard.Enabled(context.Background(), slog.LevelError) {
+		t.Error("Discard must not be enabled")
+	}
+}
@@ -0,0 +1,309 @@
+package metastore
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/sasl"
+	"github.com/bippio/go-impala/services/hive_metastore"
+	"github.com/bippio/go-impala/tlsconfig"
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+)
+
+// Options for hive metastore connection
+type Options struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+
+	UseSASL bool
+	// Mechanism is SASL mechanism: sasl.MechPlain (default), sasl.MechGSSAPI
+	// or sasl.MechDigestMD5 with DelegationToken
+	Mechanism string
+	// KerberosService is service name of metastore principal. Default is "hive"
+	KerberosService string
+	// KerberosClient provides tickets for GSSAPI. Credentials cache of kinit
+	// at KerberosCCache is loaded if it is nil
+	KerberosClient *krb5.Client
+	KerberosCCache string
+	// DelegationToken is encoded token, e.g. of HADOOP_TOKEN_FILE_LOCATION, for
+	// DIGEST-MD5
+	DelegationToken string
+	// SASLQOP lists accepted qualities of protection of GSSAPI and DIGEST-MD5
+	SASLQOP      []sasl.QOP
+	MaxFrameSize int
+
+	UseTLS         bool
+	CACertPath     string
+	ClientCertPath string
+	ClientKeyPath  string
+	// TLSServerName is verified in certificate instead of Host
+	TLSServerName string
+	// TLSMinVersion is minimum TLS version: "1.0", "1.1", "1.2" or "1.3"
+	TLSMinVersion string
+	// TLSInsecureSkipVerify skips verification of certificate. For development only
+	TLSInsecureSkipVerify bool
+	// TLSConfig is used as base TLS configuration
+	TLSConfig *tls.Config
+
+	BufferSize int
+}
+
+var (
+	// DefaultOptions for hive metastore connection
+	DefaultOptions = Options{Port: "9083", BufferSize: 4096}
+)
+
+const (
+	// DefaultKerberosService is service name of metastore principal
+	DefaultKerberosService = "hive"
+
+	// metastore creates DIGEST-MD5 server without protocol for default
+	// server name, so digest-uri is "null/default"
+	digestService = "null"
+	digestHost    = "default"
+)
+
+// Client represents Hive Metastore Client
+type Client struct {
+	t      thrift.TTransport
+	client *hive_metastore.ThriftHiveMetastoreClient
+}
+
+// NewClient creates Hive Metastore Client on top of thrift client
+func NewClient(client thrift.TClient) *Client {
+	return &Client{
+		client: hive_metastore.NewThriftHiveMetastoreClient(client),
+	}
+}
+
+// Connect opens new connection to hive metastore. Context limits dialing,
+// TLS handshake and SASL negotiation
+func Connect(ctx context.Context, opts *Options) (*Client, error) {
+	conn, err := dial(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	socket := thrift.NewTSocketFromConnTimeout(conn, 0)
+
+	var transport thrift.TTransport
+	if opts.UseSASL {
+		var so *sasl.Options
+		so, err = saslOptions(opts)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		transport, err = sasl.NewTSaslTransport(socket, so)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		// closing connection interrupts negotiation when context is done
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		err = transport.Open()
+		if !stop() {
+			return nil, fmt.Errorf("metastore: SASL negotiation interrupted: %w", ctx.Err())
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		transport = thrift.NewTBufferedTransport(socket, opts.BufferSize)
+	}
+
+	protocol := thrift.NewTBinaryProtocol(transport, false, true)
+
+	client := NewClient(thrift.NewTStandardClient(protocol, protocol))
+	client.t = transport
+	return client, nil
+}
+
+// saslOptions returns SASL options of mechanism
+func saslOptions(opts *Options) (*sasl.Options, error) {
+	so := &sasl.Options{
+		Host:     opts.Host,
+		Username: opts.Username,
+		Password: opts.Password,
+		QOP:      opts.SASLQOP,
+
+		MaxFrameSize: opts.MaxFrameSize,
+		BufferSize:   opts.BufferSize,
+	}
+
+	switch opts.Mechanism {
+	case "", sasl.MechPlain:
+	case sasl.MechGSSAPI:
+		cl := opts.KerberosClient
+		if cl == nil {
+			var err error
+			cl, err = sasl.LoadKerberosClient(opts.KerberosCCache)
+			if err != nil {
+				return nil, err
+			}
+		}
+		so.Mechanism = sasl.MechGSSAPI
+		so.KerberosClient = cl
+		so.Service = opts.KerberosService
+		if so.Service == "" {
+			so.Service = DefaultKerberosService
+		}
+	case sasl.MechDigestMD5:
+		if opts.DelegationToken == "" {
+			return nil, errors.New("metastore: delegation token is required for DIGEST-MD5")
+		}
+		token, err := sasl.ParseDelegationToken(opts.DelegationToken)
+		if err != nil {
+			return nil, err
+		}
+		so.Mechanism = sasl.MechDigestMD5
+		so.Username, so.Password = token.Credentials()
+		so.Service = digestService
+		so.Host = digestHost
+	default:
+		return nil, fmt.Errorf("metastore: SASL mechanism %s not supported", opts.Mechanism)
+	}
+	return so, nil
+}
+
+// tlsConfig returns TLS configuration of options
+func tlsConfig(opts *Options) (*tls.Config, error) {
+	cfg, err := tlsconfig.New(&tlsconfig.Options{
+		Base:               opts.TLSConfig,
+		CACertPath:         opts.CACertPath,
+		ClientCertPath:     opts.ClientCertPath,
+		ClientKeyPath:      opts.ClientKeyPath,
+		ServerName:         opts.TLSServerName,
+		MinVersion:         opts.TLSMinVersion,
+		InsecureSkipVerify: opts.TLSInsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = opts.Host
+	}
+	return cfg, nil
+}
+
+// dial connects to metastore and completes TLS handshake if it is enabled
+func dial(ctx context.Context, opts *Options) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(opts.Host, opts.Port))
+	if err != nil {
+		return nil, err
+	}
+	if !opts.UseTLS {
+		return conn, nil
+	}
+
+	cfg, err := tlsConfig(opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Close closes underlying transport
+func (c *Client) Close() error {
+	if c.t == nil {
+		return nil
+	}
+	return c.t.Close()
+}
+
+// Databases returns names of all databases
+func (c *Client) Databases(ctx context.Context) ([]string, error) {
+	names, err := c.client.GetAllDatabases(ctx)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return names, nil
+}
+
+// Database returns database by name
+func (c *Client) Database(ctx context.Context, name string) (*Database, error) {
+	db, err := c.client.GetDatabase(ctx, name)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return newDatabase(db), nil
+}
+
+// Tables returns names of all tables in database
+func (c *Client) Tables(ctx context.Context, db string) ([]string, error) {
+	names, err := c.client.GetAllTables(ctx, db)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return names, nil
+}
+
+// Table returns table by database and table name
+func (c *Client) Table(ctx context.Context, db string, name string) (*Table, error) {
+	tbl, err := c.client.GetTable(ctx, db, name)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return newTable(tbl), nil
+}
+
+// PartitionNames returns names of table partitions.
+// Negative max returns all partitions
+func (c *Client) PartitionNames(ctx context.Context, db string, table string, max int) ([]string, error) {
+	names, err := c.client.GetPartitionNames(ctx, db, table, maxParts(max))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return names, nil
+}
+
+// Partition returns table partition by its values
+func (c *Client) Partition(ctx context.Context, db string, table string, values []string) (*Partition, error) {
+	p, err := c.client.GetPartition(ctx, db, table, values)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return newPartition(p), nil
+}
+
+// Partitions returns table partitions.
+// Negative max returns all partitions
+func (c *Client) Partitions(ctx context.Context, db string, table string, max int) ([]*Partition, error) {
+	parts, err := c.client.GetPartitions(ctx, db, table, maxParts(max))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return newPartitions(parts), nil
+}
+
+// PartitionsByFilter returns table partitions matching filter expression,
+// e.g. `year = "2019" and month > "06"`. Negative max returns all partitions
+func (c *Client) PartitionsByFilter(ctx context.Context, db string, table string, filter string, max int) ([]*Partition, error) {
+	parts, err := c.client.GetPartitionsByFilter(ctx, db, table, filter, maxParts(max))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return newPartitions(parts), nil
+}
+
+func maxParts(max int) int16 {
+	if max < 0 || max > 1<<15-1 {
+		return -1
+	}
+	return int16(max)
+}
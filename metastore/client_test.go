@@ -0,0 +1,290 @@
+package metastore
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/sasl"
+	"github.com/bippio/go-impala/services/hive_metastore"
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+)
+
+// fakeMetastore serves catalog with database sales and its table orders.
+// Calls of other methods panic
+type fakeMetastore struct {
+	hive_metastore.ThriftHiveMetastore
+
+	mu       sync.Mutex
+	maxParts []int16
+}
+
+func (m *fakeMetastore) GetAllDatabases(ctx context.Context) ([]string, error) {
+	return []string{"default", "sales"}, nil
+}
+
+func (m *fakeMetastore) GetDatabase(ctx context.Context, name string) (*hive_metastore.Database, error) {
+	if name != "sales" {
+		return nil, &hive_metastore.NoSuchObjectException{Message: name}
+	}
+	return &hive_metastore.Database{
+		Name:        "sales",
+		Description: "sales data",
+		LocationUri: "hdfs:///warehouse/sales.db",
+		Parameters:  map[string]string{"owner": "etl"},
+	}, nil
+}
+
+func (m *fakeMetastore) GetAllTables(ctx context.Context, db string) ([]string, error) {
+	if db != "sales" {
+		return nil, &hive_metastore.MetaException{Message: "unknown database " + db}
+	}
+	return []string{"orders"}, nil
+}
+
+func (m *fakeMetastore) GetPartitions(ctx context.Context, db string, table string, max int16) ([]*hive_metastore.Partition, error) {
+	m.mu.Lock()
+	m.maxParts = append(m.maxParts, max)
+	m.mu.Unlock()
+
+	parts := []*hive_metastore.Partition{
+		{Values: []string{"2019"}, DbName: db, TableName: table, CreateTime: 1560000000,
+			Sd: &hive_metastore.StorageDescriptor{Location: "hdfs:///warehouse/sales.db/orders/year=2019"}},
+		{Values: []string{"2020"}, DbName: db, TableName: table, CreateTime: 1590000000,
+			Sd: &hive_metastore.StorageDescriptor{Location: "hdfs:///warehouse/sales.db/orders/year=2020"}},
+	}
+	if max >= 0 && int(max) < len(parts) {
+		parts = parts[:max]
+	}
+	return parts, nil
+}
+
+// serve starts fake metastore and returns its options
+func serve(t *testing.T, m *fakeMetastore) *Options {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				transport := thrift.NewTBufferedTransport(thrift.NewTSocketFromConnTimeout(c, 0), 4096)
+				protocol := thrift.NewTBinaryProtocol(transport, true, true)
+				processor := hive_metastore.NewThriftHiveMetastoreProcessor(m)
+				for {
+					ok, err := processor.Process(context.Background(), protocol, protocol)
+					if err != nil || !ok {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	opts := DefaultOptions
+	opts.Host, opts.Port, _ = net.SplitHostPort(ln.Addr().String())
+	return &opts
+}
+
+func TestClient(t *testing.T) {
+	m := &fakeMetastore{}
+	ctx := context.Background()
+	client, err := Connect(ctx, serve(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dbs, err := client.Databases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"default", "sales"}; !reflect.DeepEqual(dbs, want) {
+		t.Errorf("databases %v, want %v", dbs, want)
+	}
+
+	db, err := client.Database(ctx, "sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Database{
+		Name:        "sales",
+		Description: "sales data",
+		Location:    "hdfs:///warehouse/sales.db",
+		Parameters:  map[string]string{"owner": "etl"},
+	}
+	if !reflect.DeepEqual(db, want) {
+		t.Errorf("database %+v, want %+v", db, want)
+	}
+	if _, err := client.Database(ctx, "hr"); !errors.Is(err, ErrNoSuchObject) {
+		t.Errorf("expected no such object, got %v", err)
+	}
+
+	tables, err := client.Tables(ctx, "sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"orders"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables %v, want %v", tables, want)
+	}
+	if _, err := client.Tables(ctx, "hr"); !errors.Is(err, ErrMetastoreException) {
+		t.Errorf("expected metastore exception, got %v", err)
+	}
+
+	parts, err := client.Partitions(ctx, "sales", "orders", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("%d partitions, want 2", len(parts))
+	}
+	p := parts[1]
+	if !reflect.DeepEqual(p.Values, []string{"2020"}) || p.Database != "sales" || p.Table != "orders" ||
+		!p.CreateTime.Equal(time.Unix(1590000000, 0)) || p.Storage.Location != "hdfs:///warehouse/sales.db/orders/year=2020" {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	parts, err = client.Partitions(ctx, "sales", "orders", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 {
+		t.Errorf("%d partitions, want 1", len(parts))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if want := []int16{-1, 1}; !reflect.DeepEqual(m.maxParts, want) {
+		t.Errorf("max partitions %v, want %v", m.maxParts, want)
+	}
+}
+
+func TestConnectContext(t *testing.T) {
+	// listener accepts connections but never answers SASL negotiation
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	opts := DefaultOptions
+	opts.Host, opts.Port, _ = net.SplitHostPort(ln.Addr().String())
+	opts.UseSASL = true
+	opts.Username = "etl"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Connect(ctx, &opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Connect(cancelled, &opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled, got %v", err)
+	}
+}
+
+func TestSASLOptions(t *testing.T) {
+	token := (&sasl.DelegationToken{Identifier: []byte("id"), Password: []byte("pw"), Kind: "HIVE_DELEGATION_TOKEN"}).String()
+	cl := &krb5.Client{}
+
+	tests := []struct {
+		name string
+		opts Options
+		out  *sasl.Options
+		err  string
+	}{
+		{
+			name: "plain",
+			opts: Options{Host: "hms", Username: "etl", Password: "secret", BufferSize: 4096},
+			out:  &sasl.Options{Host: "hms", Username: "etl", Password: "secret", BufferSize: 4096},
+		},
+		{
+			name: "gssapi",
+			opts: Options{Host: "hms", Mechanism: sasl.MechGSSAPI, KerberosClient: cl, SASLQOP: []sasl.QOP{sasl.QOPConfidentiality}},
+			out:  &sasl.Options{Service: "hive", Host: "hms", Mechanism: sasl.MechGSSAPI, KerberosClient: cl, QOP: []sasl.QOP{sasl.QOPConfidentiality}},
+		},
+		{
+			name: "gssapi service",
+			opts: Options{Host: "hms", Mechanism: sasl.MechGSSAPI, KerberosClient: cl, KerberosService: "metastore"},
+			out:  &sasl.Options{Service: "metastore", Host: "hms", Mechanism: sasl.MechGSSAPI, KerberosClient: cl},
+		},
+		{
+			name: "digest",
+			opts: Options{Host: "hms", Mechanism: sasl.MechDigestMD5, DelegationToken: token},
+			out:  &sasl.Options{Service: "null", Host: "default", Username: "aWQ=", Password: "cHc=", Mechanism: sasl.MechDigestMD5},
+		},
+		{
+			name: "missing ccache",
+			opts: Options{Mechanism: sasl.MechGSSAPI, KerberosCCache: "/nonexistent"},
+			err:  "failed to load kerberos credentials cache /nonexistent",
+		},
+		{
+			name: "missing token",
+			opts: Options{Mechanism: sasl.MechDigestMD5},
+			err:  "delegation token is required",
+		},
+		{
+			name: "unknown mechanism",
+			opts: Options{Mechanism: "CRAM-MD5"},
+			err:  "SASL mechanism CRAM-MD5 not supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			so, err := saslOptions(&tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(so, tt.out) {
+				t.Errorf("got %+v, want %+v", so, tt.out)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	cfg, err := tlsConfig(&Options{Host: "hms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerName != "hms" || cfg.InsecureSkipVerify {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	cfg, err = tlsConfig(&Options{Host: "10.0.0.1", TLSServerName: "hms.example.com", TLSMinVersion: "1.2", TLSInsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerName != "hms.example.com" || cfg.MinVersion != tls.VersionTLS12 || !cfg.InsecureSkipVerify {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	if _, err := tlsConfig(&Options{ClientCertPath: "client.pem"}); err == nil {
+		t.Error("expected error for client certificate without key")
+	}
+	if _, err := tlsConfig(&Options{TLSMinVersion: "1.4"}); err == nil {
+		t.Error("expected error for unknown tls version")
+	}
+}
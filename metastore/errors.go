@@ -0,0 +1,60 @@
+package metastore
+
+import (
+	"errors"
+
+	"github.com/bippio/go-impala/services/hive_metastore"
+)
+
+// Metastore errors. Exceptions returned by metastore are mapped to *Error
+// which matches one of these with errors.Is
+var (
+	ErrNoSuchObject       = errors.New("metastore: no such object")
+	ErrAlreadyExists      = errors.New("metastore: already exists")
+	ErrInvalidObject      = errors.New("metastore: invalid object")
+	ErrInvalidOperation   = errors.New("metastore: invalid operation")
+	ErrConfigValSecurity  = errors.New("metastore: config value security")
+	ErrMetastoreException = errors.New("metastore: exception")
+)
+
+// Error is metastore exception
+type Error struct {
+	// Kind is one of the metastore errors
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Message
+}
+
+// Unwrap returns kind of the error
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func wrap(err error) error {
+	switch e := err.(type) {
+	case *hive_metastore.NoSuchObjectException:
+		return &Error{Kind: ErrNoSuchObject, Message: e.GetMessage()}
+	case *hive_metastore.UnknownDBException:
+		return &Error{Kind: ErrNoSuchObject, Message: e.GetMessage()}
+	case *hive_metastore.UnknownTableException:
+		return &Error{Kind: ErrNoSuchObject, Message: e.GetMessage()}
+	case *hive_metastore.AlreadyExistsException:
+		return &Error{Kind: ErrAlreadyExists, Message: e.GetMessage()}
+	case *hive_metastore.InvalidObjectException:
+		return &Error{Kind: ErrInvalidObject, Message: e.GetMessage()}
+	case *hive_metastore.InvalidOperationException:
+		return &Error{Kind: ErrInvalidOperation, Message: e.GetMessage()}
+	case *hive_metastore.ConfigValSecurityException:
+		return &Error{Kind: ErrConfigValSecurity, Message: e.GetMessage()}
+	case *hive_metastore.MetaException:
+		return &Error{Kind: ErrMetastoreException, Message: e.GetMessage()}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,56 @@
+package metastore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bippio/go-impala/services/hive_metastore"
+)
+
+func TestWrap(t *testing.T) {
+	other := errors.New("connection refused")
+
+	tests := []struct {
+		in   error
+		kind error
+		msg  string
+	}{
+		{in: &hive_metastore.NoSuchObjectException{Message: "sales.orders table not found"}, kind: ErrNoSuchObject, msg: "metastore: no such object: sales.orders table not found"},
+		{in: &hive_metastore.UnknownDBException{Message: "sales"}, kind: ErrNoSuchObject, msg: "metastore: no such object: sales"},
+		{in: &hive_metastore.UnknownTableException{}, kind: ErrNoSuchObject, msg: "metastore: no such object"},
+		{in: &hive_metastore.AlreadyExistsException{Message: "sales"}, kind: ErrAlreadyExists, msg: "metastore: already exists: sales"},
+		{in: &hive_metastore.InvalidOperationException{Message: "op"}, kind: ErrInvalidOperation, msg: "metastore: invalid operation: op"},
+		{in: &hive_metastore.MetaException{Message: "filter"}, kind: ErrMetastoreException, msg: "metastore: exception: filter"},
+		{in: other, kind: other, msg: "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			err := wrap(tt.in)
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("got: %v, want kind: %v", err, tt.kind)
+			}
+			if err.Error() != tt.msg {
+				t.Errorf("got: %q, want: %q", err.Error(), tt.msg)
+			}
+		})
+	}
+}
+
+func TestMaxParts(t *testing.T) {
+	tests := []struct {
+		in  int
+		out int16
+	}{
+		{in: -1, out: -1},
+		{in: 0, out: 0},
+		{in: 100, out: 100},
+		{in: 1 << 20, out: -1},
+	}
+
+	for _, tt := range tests {
+		if got := maxParts(tt.in); got != tt.out {
+			t.Errorf("maxParts(%d) = %d, want: %d", tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package metastore
+
+import (
+	"time"
+
+	"github.com/bippio/go-impala/services/hive_metastore"
+)
+
+// Database represents metastore database
+type Database struct {
+	Name        string
+	Description string
+	Location    string
+	Parameters  map[string]string
+}
+
+// Column represents table or partition column
+type Column struct {
+	Name    string
+	Type    string
+	Comment string
+}
+
+// Storage describes where and how data is stored
+type Storage struct {
+	Location     string
+	InputFormat  string
+	OutputFormat string
+	SerDe        string
+	Compressed   bool
+	NumBuckets   int
+	BucketCols   []string
+	Parameters   map[string]string
+}
+
+// Table represents metastore table
+type Table struct {
+	Name          string
+	Database      string
+	Owner         string
+	Type          string
+	CreateTime    time.Time
+	Columns       []*Column
+	PartitionKeys []*Column
+	Storage       *Storage
+	Parameters    map[string]string
+
+	ViewOriginalText string
+	ViewExpandedText string
+}
+
+// Partition represents table partition
+type Partition struct {
+	Values     []string
+	Database   string
+	Table      string
+	CreateTime time.Time
+	Storage    *Storage
+	Parameters map[string]string
+}
+
+func newDatabase(db *hive_metastore.Database) *Database {
+	return &Database{
+		Name:        db.GetName(),
+		Description: db.GetDescription(),
+		Location:    db.GetLocationUri(),
+		Parameters:  db.GetParameters(),
+	}
+}
+
+func newTable(tbl *hive_metastore.Table) *Table {
+	t := &Table{
+		Name:          tbl.GetTableName(),
+		Database:      tbl.GetDbName(),
+		Owner:         tbl.GetOwner(),
+		Type:          tbl.GetTableType(),
+		CreateTime:    unix(tbl.GetCreateTime()),
+		PartitionKeys: newColumns(tbl.GetPartitionKeys()),
+		Parameters:    tbl.GetParameters(),
+
+		ViewOriginalText: tbl.GetViewOriginalText(),
+		ViewExpandedText: tbl.GetViewExpandedText(),
+	}
+	if tbl.IsSetSd() {
+		t.Columns = newColumns(tbl.Sd.GetCols())
+		t.Storage = newStorage(tbl.Sd)
+	}
+	return t
+}
+
+func newPartition(p *hive_metastore.Partition) *Partition {
+	part := &Partition{
+		Values:     p.GetValues(),
+		Database:   p.GetDbName(),
+		Table:      p.GetTableName(),
+		CreateTime: unix(p.GetCreateTime()),
+		Parameters: p.GetParameters(),
+	}
+	if p.IsSetSd() {
+		part.Storage = newStorage(p.Sd)
+	}
+	return part
+}
+
+func newPartitions(parts []*hive_metastore.Partition) []*Partition {
+	res := make([]*Partition, 0, len(parts))
+	for _, p := range parts {
+		res = append(res, newPartition(p))
+	}
+	return res
+}
+
+func newColumns(fields []*hive_metastore.FieldSchema) []*Column {
+	var cols []*Column
+	for _, f := range fields {
+		cols = append(cols, &Column{Name: f.GetName(), Type: f.GetType(), Comment: f.GetComment()})
+	}
+	return cols
+}
+
+func newStorage(sd *hive_metastore.StorageDescriptor) *Storage {
+	s := &Storage{
+		Location:     sd.GetLocation(),
+		InputFormat:  sd.GetInputFormat(),
+		OutputFormat: sd.GetOutputFormat(),
+		Compressed:   sd.GetCompressed(),
+		NumBuckets:   int(sd.GetNumBuckets()),
+		BucketCols:   sd.GetBucketCols(),
+		Parameters:   sd.GetParameters(),
+	}
+	if sd.IsSetSerdeInfo() {
+		s.SerDe = sd.SerdeInfo.GetSerializationLib()
+	}
+	return s
+}
+
+func unix(sec int32) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(sec), 0)
+}
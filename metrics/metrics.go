@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Phase of statement execution
+type Phase string
+
+// Phases of statement execution. Latencies are measured from the start of execution
+const (
+	// PhaseExecute ends when server accepts statement
+	PhaseExecute Phase = "execute"
+	// PhaseFirstRow ends when first row is returned to the caller
+	PhaseFirstRow Phase = "first_row"
+	// PhaseFetch ends when all rows are fetched
+	PhaseFetch Phase = "fetch"
+)
+
+// Outcome of statement
+type Outcome string
+
+// Statement outcomes
+const (
+	OutcomeSuccess  Outcome = "success"
+	OutcomeError    Outcome = "error"
+	OutcomeCanceled Outcome = "canceled"
+)
+
+// Hook receives driver metrics. Implementations must be safe for concurrent use
+type Hook interface {
+	SessionOpened()
+	SessionClosed()
+	StatementFinished(outcome Outcome)
+	FetchRoundTrip()
+	RowsReceived(n int)
+	BytesReceived(n int)
+	ObserveLatency(phase Phase, d time.Duration)
+}
+
+// Nop is hook which drops all metrics
+type Nop struct{}
+
+// SessionOpened is no-op
+func (Nop) SessionOpened() {}
+
+// SessionClosed is no-op
+func (Nop) SessionClosed() {}
+
+// StatementFinished is no-op
+func (Nop) StatementFinished(Outcome) {}
+
+// FetchRoundTrip is no-op
+func (Nop) FetchRoundTrip() {}
+
+// RowsReceived is no-op
+func (Nop) RowsReceived(int) {}
+
+// BytesReceived is no-op
+func (Nop) BytesReceived(int) {}
+
+// ObserveLatency is no-op
+func (Nop) ObserveLatency(Phase, time.Duration) {}
+
+// OutcomeOf classifies statement error
+func OutcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return OutcomeCanceled
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected Outcome
+	}{
+		{err: nil, expected: OutcomeSuccess},
+		{err: errors.New("boom"), expected: OutcomeError},
+		{err: context.Canceled, expected: OutcomeCanceled},
+		{err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), expected: OutcomeCanceled},
+	}
+
+	for _, tt := range tests {
+		if actual := OutcomeOf(tt.err); actual != tt.expected {
+			t.Errorf("OutcomeOf(%v) = %q, want %q", tt.err, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/bippio/go-impala/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace of driver metrics
+const Namespace = "impala"
+
+// Hook exports driver metrics as prometheus collectors
+type Hook struct {
+	sessionsOpened prometheus.Counter
+	sessionsClosed prometheus.Counter
+	statements     *prometheus.CounterVec
+	roundTrips     prometheus.Counter
+	rows           prometheus.Counter
+	bytes          prometheus.Counter
+	latency        *prometheus.HistogramVec
+}
+
+// NewHook creates hook and registers its collectors.
+// Default registerer is used if reg is nil
+func NewHook(reg prometheus.Registerer) (*Hook, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	h := &Hook{
+		sessionsOpened: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "sessions_opened_total",
+			Help:      "Number of opened sessions.",
+		}),
+		sessionsClosed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "sessions_closed_total",
+			Help:      "Number of closed sessions.",
+		}),
+		statements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "statements_total",
+			Help:      "Number of executed statements by outcome.",
+		}, []string{"outcome"}),
+		roundTrips: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "fetch_round_trips_total",
+			Help:      "Number of fetch requests.",
+		}),
+		rows: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "rows_received_total",
+			Help:      "Number of received rows.",
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_received_total",
+			Help:      "Number of bytes received from server.",
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "statement_phase_duration_seconds",
+			Help:      "Time from the start of statement execution to the end of the phase.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 16),
+		}, []string{"phase"}),
+	}
+
+	collectors := []prometheus.Collector{
+		h.sessionsOpened, h.sessionsClosed, h.statements, h.roundTrips, h.rows, h.bytes, h.latency,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// SessionOpened counts opened session
+func (h *Hook) SessionOpened() {
+	h.sessionsOpened.Inc()
+}
+
+// SessionClosed counts closed session
+func (h *Hook) SessionClosed() {
+	h.sessionsClosed.Inc()
+}
+
+// StatementFinished counts statement by outcome
+func (h *Hook) StatementFinished(outcome metrics.Outcome) {
+	h.statements.WithLabelValues(string(outcome)).Inc()
+}
+
+// FetchRoundTrip counts fetch request
+func (h *Hook) FetchRoundTrip() {
+	h.roundTrips.Inc()
+}
+
+// RowsReceived counts received rows
+func (h *Hook) RowsReceived(n int) {
+	h.rows.Add(float64(n))
+}
+
+// BytesReceived counts received bytes
+func (h *Hook) BytesReceived(n int) {
+	h.bytes.Add(float64(n))
+}
+
+// ObserveLatency records phase latency
+func (h *Hook) ObserveLatency(phase metrics.Phase, d time.Duration) {
+	h.latency.WithLabelValues(string(phase)).Observe(d.Seconds())
+}
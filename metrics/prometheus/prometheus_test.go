@@ -0,0 +1,43 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bippio/go-impala/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHook(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	hook, err := NewHook(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook.SessionOpened()
+	hook.StatementFinished(metrics.OutcomeSuccess)
+	hook.StatementFinished(metrics.OutcomeCanceled)
+	hook.StatementFinished(metrics.OutcomeSuccess)
+	hook.RowsReceived(10)
+	hook.RowsReceived(5)
+	hook.ObserveLatency(metrics.PhaseExecute, 10*time.Millisecond)
+
+	if v := testutil.ToFloat64(hook.sessionsOpened); v != 1 {
+		t.Errorf("sessions opened = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(hook.statements.WithLabelValues("success")); v != 2 {
+		t.Errorf("successful statements = %v, want 2", v)
+	}
+	if v := testutil.ToFloat64(hook.rows); v != 15 {
+		t.Errorf("rows = %v, want 15", v)
+	}
+	if n := testutil.CollectAndCount(hook.latency); n != 1 {
+		t.Errorf("latency series = %d, want 1", n)
+	}
+
+	if _, err := NewHook(reg); err == nil {
+		t.Error("expected error registering collectors twice")
+	}
+}
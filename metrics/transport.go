@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// Transport reports bytes read from underlying transport to hook
+type Transport struct {
+	thrift.TTransport
+	hook Hook
+}
+
+// NewTransport wraps transport to count received bytes
+func NewTransport(t thrift.TTransport, hook Hook) *Transport {
+	return &Transport{TTransport: t, hook: hook}
+}
+
+func (t *Transport) Read(buf []byte) (int, error) {
+	n, err := t.TTransport.Read(buf)
+	if n > 0 {
+		t.hook.BytesReceived(n)
+	}
+	return n, err
+}
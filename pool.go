@@ -0,0 +1,39 @@
+package impala
+
+import (
+	"context"
+	"errors"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/hive"
+)
+
+// DialHive connects with options as the driver does, including retries,
+// and returns hive client of the connection and its transport, which
+// closes it. It is for users of hive package, e.g. to get operation handles
+func DialHive(ctx context.Context, opts *Options) (*hive.Client, thrift.TTransport, error) {
+	if opts.Protocol == ProtocolBeeswax {
+		return nil, nil, errors.New("impala: hive client requires protocol hs2 or hs2-http")
+	}
+	transport, tclient, logger, err := openClient(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newHiveClient(tclient, logger, opts), transport, nil
+}
+
+// NewHivePool creates pool of hive sessions connected with options.
+// Sessions use database and impersonated user of options, unless
+// configuration of pool options is set
+func NewHivePool(opts *Options, poolOpts *hive.PoolOptions) *hive.Pool {
+	var po hive.PoolOptions
+	if poolOpts != nil {
+		po = *poolOpts
+	}
+	if po.Config == nil {
+		po.Config = sessionConfig(opts.ImpersonateUser, opts.Database)
+	}
+	return hive.NewPool(func(ctx context.Context) (*hive.Client, thrift.TTransport, error) {
+		return DialHive(ctx, opts)
+	}, &po)
+}
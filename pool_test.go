@@ -0,0 +1,301 @@
+package impala
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/impalatest"
+)
+
+func poolServer(t *testing.T, poolOpts *hive.PoolOptions) (*impalatest.Server, *hive.Pool) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+	opts := DefaultOptions
+	opts.Host, opts.Port = srv.Host(), srv.Port()
+	opts.Database = "sales"
+
+	pool := NewHivePool(&opts, poolOpts)
+	t.Cleanup(func() { pool.Close() })
+	return srv, pool
+}
+
+// waitFor polls cond until it holds or test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHivePool(t *testing.T) {
+	srv, pool := poolServer(t, &hive.PoolOptions{MaxOpen: 1, HealthCheckPeriod: -1})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		s, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		op, err := s.ExecuteStatement(ctx, "SELECT 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		op.Close(ctx)
+		s.Release()
+		s.Release()
+	}
+	if stats := pool.Stats(); stats != (hive.PoolStats{Open: 1, Idle: 1}) {
+		t.Errorf("stats %+v, want one idle connection", stats)
+	}
+	sessions := srv.Sessions()
+	if len(sessions) != 1 || sessions[0].Configuration[hive.ConfUseDatabase] != "sales" {
+		t.Errorf("sessions %+v, want one of database sales", sessions)
+	}
+
+	// acquire waits for release until deadline
+	s, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.Discard()
+	}()
+	s, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := pool.Stats(); stats != (hive.PoolStats{Open: 1, InUse: 1}) {
+		t.Errorf("stats %+v, want one connection in use", stats)
+	}
+	s.Release()
+
+	pool.Close()
+	if _, err := pool.Acquire(ctx); err != hive.ErrPoolClosed {
+		t.Errorf("expected closed pool, got %v", err)
+	}
+	if stats := pool.Stats(); stats.Open != 0 {
+		t.Errorf("stats %+v after close", stats)
+	}
+}
+
+func TestHivePoolAcquireTimeout(t *testing.T) {
+	_, pool := poolServer(t, &hive.PoolOptions{MaxOpen: 1, HealthCheckPeriod: -1, AcquireTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	s, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+	if _, err := pool.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestHivePoolMaxLifetime(t *testing.T) {
+	srv, pool := poolServer(t, &hive.PoolOptions{MaxLifetime: 50 * time.Millisecond, HealthCheckPeriod: -1})
+	ctx := context.Background()
+
+	s, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Release()
+	time.Sleep(60 * time.Millisecond)
+
+	s, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+	if stats := pool.Stats(); stats.Open != 1 {
+		t.Errorf("stats %+v, want expired connection closed", stats)
+	}
+	// expired session is closed in background
+	waitFor(t, func() bool { return len(srv.Sessions()) == 1 })
+}
+
+func TestHivePoolStalledClose(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	opts := DefaultOptions
+	opts.Host, opts.Port = srv.Host(), srv.Port()
+	// server stalls on closing sessions
+	opts.WrapClient = func(c thrift.TClient) thrift.TClient {
+		return slowClient{TClient: c, method: "CloseSession", delay: 500 * time.Millisecond}
+	}
+	pool := NewHivePool(&opts, &hive.PoolOptions{MaxLifetime: 20 * time.Millisecond, HealthCheckPeriod: -1})
+	defer pool.Close()
+	ctx := context.Background()
+
+	s, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Release()
+	time.Sleep(30 * time.Millisecond)
+
+	// acquire closes expired connection without waiting for server
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s, err = pool.Acquire(timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("acquire took %v, want its deadline honored", elapsed)
+	}
+
+	// release closes expired connection without waiting for server
+	time.Sleep(30 * time.Millisecond)
+	start = time.Now()
+	s.Release()
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("release took %v", elapsed)
+	}
+
+	// close does not wait for server either
+	pool = NewHivePool(&opts, &hive.PoolOptions{HealthCheckPeriod: -1})
+	s, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Release()
+	start = time.Now()
+	pool.Close()
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("close took %v", elapsed)
+	}
+	if stats := pool.Stats(); stats.Open != 0 {
+		t.Errorf("stats %+v after close", stats)
+	}
+}
+
+func TestHivePoolHealthCheck(t *testing.T) {
+	srv, pool := poolServer(t, &hive.PoolOptions{MinIdle: 2, HealthCheckPeriod: 10 * time.Millisecond})
+
+	waitFor(t, func() bool { return pool.Stats().Idle == 2 })
+	if n := len(srv.Sessions()); n != 2 {
+		t.Errorf("%d sessions, want 2", n)
+	}
+
+	// sessions lost by server are replaced
+	srv.ResetSessions()
+	waitFor(t, func() bool { return len(srv.Sessions()) == 2 })
+	if stats := pool.Stats(); stats.Open != 2 {
+		t.Errorf("stats %+v, want 2 connections", stats)
+	}
+
+	s, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+	if err := s.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHivePoolHealthCheckLimit(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	opts := DefaultOptions
+	opts.Host, opts.Port = srv.Host(), srv.Port()
+	// slow pings keep connections in health check
+	opts.WrapClient = func(c thrift.TClient) thrift.TClient {
+		return slowClient{TClient: c, method: "GetInfo", delay: 20 * time.Millisecond}
+	}
+	pool := NewHivePool(&opts, &hive.PoolOptions{MaxOpen: 1, MinIdle: 1, HealthCheckPeriod: 30 * time.Millisecond})
+	defer pool.Close()
+
+	waitFor(t, func() bool { return pool.Stats().Idle == 1 })
+	ctx := context.Background()
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+		s, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats := pool.Stats(); stats.Open > 1 {
+			t.Fatalf("stats %+v exceed MaxOpen", stats)
+		}
+		s.Release()
+	}
+	if n := len(srv.Sessions()); n != 1 {
+		t.Errorf("%d sessions, want 1", n)
+	}
+}
+
+func TestHivePooledSessionReleased(t *testing.T) {
+	srv, pool := poolServer(t, &hive.PoolOptions{HealthCheckPeriod: -1})
+	ctx := context.Background()
+
+	s, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Client() == nil {
+		t.Error("no client of acquired session")
+	}
+	s.Release()
+
+	if _, err := s.ExecuteStatement(ctx, "SELECT 1"); err != hive.ErrReleased {
+		t.Errorf("expected released session, got %v", err)
+	}
+	if err := s.Ping(ctx); err != hive.ErrReleased {
+		t.Errorf("expected released session, got %v", err)
+	}
+	if s.Client() != nil {
+		t.Error("client of released session")
+	}
+
+	// pooled session stays open
+	s, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+	if err := s.Ping(ctx); err != nil {
+		t.Error(err)
+	}
+	if n := len(srv.Sessions()); n != 1 {
+		t.Errorf("%d sessions, want 1", n)
+	}
+}
+
+// slowClient delays calls of method
+type slowClient struct {
+	thrift.TClient
+	method string
+	delay  time.Duration
+}
+
+func (c slowClient) Call(ctx context.Context, method string, args, result thrift.TStruct) error {
+	if method == c.method {
+		time.Sleep(c.delay)
+	}
+	return c.TClient.Call(ctx, method, args, result)
+}
+
+func TestDialHive(t *testing.T) {
+	opts := DefaultOptions
+	opts.Protocol = ProtocolBeeswax
+	if _, _, err := DialHive(context.Background(), &opts); err == nil {
+		t.Error("expected error with beeswax")
+	}
+}
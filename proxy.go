@@ -0,0 +1,192 @@
+package impala
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/proxy"
+)
+
+// Dialer opens network connections, e.g. through a bastion host.
+// *net.Dialer and SOCKS5 dialer of golang.org/x/net/proxy implement it
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewProxyDialer creates dialer which connects through proxy at u. Schemes
+// socks5, socks5h, http and https (HTTP CONNECT) are supported. Credentials of
+// u authenticate with proxy. Forward dialer connects to proxy, net.Dialer is
+// used if nil
+func NewProxyDialer(u *url.URL, forward Dialer) (Dialer, error) {
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			auth = &proxy.Auth{User: u.User.Username()}
+			auth.Password, _ = u.User.Password()
+		}
+		d, err := proxy.SOCKS5("tcp", hostPort(u, "1080"), auth, forwardDialer{forward})
+		if err != nil {
+			return nil, err
+		}
+		return d.(Dialer), nil
+	case "http", "https":
+		return &connectDialer{proxy: u, forward: forward}, nil
+	default:
+		return nil, fmt.Errorf("impala: unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// newDialer returns Options.Dialer, or dialer through proxy of options
+func newDialer(opts *Options) (Dialer, error) {
+	if opts.Dialer != nil {
+		return opts.Dialer, nil
+	}
+	direct := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: opts.KeepAlive}
+
+	u, err := proxyURL(opts)
+	if err != nil || u == nil {
+		return direct, err
+	}
+	d, err := NewProxyDialer(u, direct)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Proxy == "" {
+		// hosts of NO_PROXY are connected directly
+		if noProxy := getEnv("NO_PROXY", "no_proxy"); noProxy != "" {
+			perHost := proxy.NewPerHost(forwardDialer{d}, forwardDialer{direct})
+			perHost.AddFromString(noProxy)
+			return perHost, nil
+		}
+	}
+	return d, nil
+}
+
+// proxyURL returns Options.Proxy, or ALL_PROXY when ProxyFromEnvironment
+// is set. Nil means direct connection
+func proxyURL(opts *Options) (*url.URL, error) {
+	s := opts.Proxy
+	if s == "" && opts.ProxyFromEnvironment {
+		s = getEnv("ALL_PROXY", "all_proxy")
+	}
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("impala: invalid proxy: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("impala: proxy %s without host", u.Redacted())
+	}
+	return u, nil
+}
+
+// getEnv returns value of the first set environment variable
+func getEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// hostPort returns host of u with default port if it has none
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// forwardDialer adapts Dialer to golang.org/x/net/proxy, which uses
+// DialContext when available
+type forwardDialer struct {
+	Dialer
+}
+
+func (d forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// connectDialer opens tunnels with HTTP CONNECT method
+type connectDialer struct {
+	proxy   *url.URL
+	forward Dialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	port := "80"
+	if d.proxy.Scheme == "https" {
+		port = "443"
+	}
+	conn, err := d.forward.DialContext(ctx, "tcp", hostPort(d.proxy, port))
+	if err != nil {
+		return nil, err
+	}
+
+	// closing connection interrupts handshake when context is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	tunnel, err := d.connect(conn, addr)
+	if !stop() {
+		return nil, fmt.Errorf("impala: proxy handshake interrupted: %w", ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// connect requests tunnel to addr over connection to proxy
+func (d *connectDialer) connect(conn net.Conn, addr string) (net.Conn, error) {
+	if d.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.proxy.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		password, _ := d.proxy.User.Password()
+		req.SetBasicAuth(d.proxy.User.Username(), password)
+		req.Header["Proxy-Authorization"] = req.Header["Authorization"]
+		delete(req.Header, "Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("impala: proxy %s responded %s", d.proxy.Host, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return nil, errors.New("impala: proxy sent data before tunnel was used")
+	}
+	return conn, nil
+}
@@ -0,0 +1,257 @@
+package impala
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bippio/go-impala/impalatest"
+)
+
+// socksProxy serves SOCKS5 CONNECT with optional username and password
+func socksProxy(t *testing.T, username, password string) (string, *int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var tunnels int32
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				target, err := socksHandshake(bufio.NewReader(c), c, username, password)
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(&tunnels, 1)
+				relay(c, target)
+			}()
+		}
+	}()
+	return ln.Addr().String(), &tunnels
+}
+
+func socksHandshake(r *bufio.Reader, w io.Writer, username, password string) (net.Conn, error) {
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+
+	hdr, err := read(2)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := read(int(hdr[1])); err != nil {
+		return nil, err
+	}
+	if username == "" {
+		w.Write([]byte{5, 0})
+	} else {
+		w.Write([]byte{5, 2})
+		ver, err := read(2)
+		if err != nil {
+			return nil, err
+		}
+		user, _ := read(int(ver[1]))
+		n, _ := read(1)
+		pass, _ := read(int(n[0]))
+		if string(user) != username || string(pass) != password {
+			w.Write([]byte{1, 1})
+			return nil, io.EOF
+		}
+		w.Write([]byte{1, 0})
+	}
+
+	req, err := read(4)
+	if err != nil {
+		return nil, err
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip, _ := read(4)
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := read(1)
+		name, _ := read(int(n[0]))
+		host = string(name)
+	default:
+		return nil, io.EOF
+	}
+	port, err := read(2)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		w.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	w.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return target, nil
+}
+
+// connectProxy serves HTTP CONNECT with optional basic authentication
+func connectProxy(t *testing.T, username, password string) (*httptest.Server, *int32) {
+	var tunnels int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if username != "" {
+			r.Header.Set("Authorization", r.Header.Get("Proxy-Authorization"))
+			if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+				http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+				return
+			}
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+		atomic.AddInt32(&tunnels, 1)
+		relay(c, target)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &tunnels
+}
+
+// relay copies data between connections until either is closed
+func relay(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+	io.Copy(b, a)
+	b.Close()
+}
+
+func TestServerProxy(t *testing.T) {
+	srv := newServer(t, impalatest.Options{Username: "admin", Password: "secret", TLS: true})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	socks, socksTunnels := socksProxy(t, "", "")
+	socksAuth, socksAuthTunnels := socksProxy(t, "bastion", "pass")
+	connect, connectTunnels := connectProxy(t, "", "")
+	connectAuth, connectAuthTunnels := connectProxy(t, "bastion", "pass")
+
+	tests := []struct {
+		name    string
+		proxy   string
+		tunnels *int32
+		err     string
+	}{
+		{"socks5", "socks5://" + socks, socksTunnels, ""},
+		{"socks5 auth", "socks5h://bastion:pass@" + socksAuth, socksAuthTunnels, ""},
+		{"socks5 wrong password", "socks5://bastion:wrong@" + socksAuth, nil, "username/password authentication failed"},
+		{"connect", connect.URL, connectTunnels, ""},
+		{"connect auth", strings.Replace(connectAuth.URL, "http://", "http://bastion:pass@", 1), connectAuthTunnels, ""},
+		{"connect without credentials", connectAuth.URL, nil, "407 Proxy Authentication Required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openServer(t, srv, func(opts *Options) {
+				opts.UseLDAP = true
+				opts.Username = "admin"
+				opts.Password = "secret"
+				opts.UseTLS = true
+				opts.TLSConfig = &tls.Config{RootCAs: pool}
+				opts.Proxy = tt.proxy
+			})
+			var v int8
+			err := db.QueryRow("SELECT 1").Scan(&v)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if atomic.LoadInt32(tt.tunnels) == 0 {
+				t.Error("connection did not go through proxy")
+			}
+		})
+	}
+}
+
+func TestServerProxyFromEnvironment(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	socks, tunnels := socksProxy(t, "", "")
+	t.Setenv("ALL_PROXY", "socks5://"+socks)
+	t.Setenv("NO_PROXY", "")
+
+	ping := func(fromEnv bool) {
+		db := openServer(t, srv, func(opts *Options) {
+			opts.ProxyFromEnvironment = fromEnv
+		})
+		if err := db.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// environment is ignored unless enabled
+	ping(false)
+	if n := atomic.LoadInt32(tunnels); n != 0 {
+		t.Fatalf("%d connections through proxy, want 0", n)
+	}
+	ping(true)
+	if n := atomic.LoadInt32(tunnels); n != 1 {
+		t.Fatalf("%d connections through proxy, want 1", n)
+	}
+
+	t.Setenv("NO_PROXY", srv.Host())
+	ping(true)
+	if n := atomic.LoadInt32(tunnels); n != 1 {
+		t.Errorf("%d connections through proxy, want 1 with NO_PROXY", n)
+	}
+}
+
+func TestServerHTTPProxy(t *testing.T) {
+	srv := newServer(t, impalatest.Options{HTTP: true})
+	socks, tunnels := socksProxy(t, "", "")
+
+	db := openServer(t, srv, func(opts *Options) {
+		opts.Protocol = ProtocolHiveServer2HTTP
+		opts.Proxy = (&url.URL{Scheme: "socks5", Host: socks}).String()
+	})
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(tunnels) == 0 {
+		t.Error("connection did not go through proxy")
+	}
+}
@@ -0,0 +1,100 @@
+// Package recording records thrift RPC calls to JSONL files and replays them.
+//
+// Recorder wraps thrift client of a live session and writes each request and
+// response pair as a JSON line. Server plays recorded responses back in the
+// same order, so that the driver can be tested against captured cluster
+// behaviour without network access to the cluster.
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// Entry is recorded RPC call
+type Entry struct {
+	Method string          `json:"method"`
+	Args   json.RawMessage `json:"args"`
+	Result json.RawMessage `json:"result,omitempty"`
+	// Error of the call, e.g. transport failure. Result is not set
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder writes RPC calls as JSON lines. It is safe for concurrent use
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Client returns client which records calls made through c
+func (r *Recorder) Client(c thrift.TClient) thrift.TClient {
+	return &client{TClient: c, r: r}
+}
+
+// Err returns first error of writing entries
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(method string, args, result thrift.TStruct, callErr error) {
+	entry := Entry{Method: method}
+
+	var err error
+	entry.Args, err = json.Marshal(args)
+	if err == nil {
+		if callErr != nil {
+			entry.Error = callErr.Error()
+		} else {
+			entry.Result, err = json.Marshal(result)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		err = r.enc.Encode(entry)
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+type client struct {
+	thrift.TClient
+	r *Recorder
+}
+
+func (c *client) Call(ctx context.Context, method string, args, result thrift.TStruct) error {
+	err := c.TClient.Call(ctx, method, args, result)
+	c.r.record(method, args, result, err)
+	return err
+}
+
+// ReadEntries reads recorded entries
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	dec := json.NewDecoder(r)
+	for {
+		var entry Entry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,140 @@
+package recording
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	impala "github.com/bippio/go-impala"
+	"github.com/bippio/go-impala/impalatest"
+)
+
+func open(t *testing.T, addr string, rec *Recorder) *sql.DB {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := impala.DefaultOptions
+	opts.Host = host
+	opts.Port = port
+	if rec != nil {
+		opts.WrapClient = rec.Client
+	}
+	db := sql.OpenDB(impala.NewConnector(&opts))
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+// session runs statements and returns results
+func session(db *sql.DB) ([]string, error) {
+	var names []string
+	rows, err := db.Query("SELECT name FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name sql.NullString
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec("DROP TABLE users"); err == nil {
+		return nil, errors.New("expected error")
+	} else {
+		names = append(names, err.Error())
+	}
+	return names, nil
+}
+
+func record(t *testing.T) ([]Entry, []string) {
+	srv, err := impalatest.NewServer(impalatest.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Handle("SELECT name FROM users", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "name", Type: "STRING"}},
+		Rows:    [][]interface{}{{"alice"}, {nil}, {"bob"}},
+	})
+	srv.Handle("DROP TABLE users", &impalatest.Result{Err: errors.New("AuthorizationException: denied")})
+
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	db := open(t, srv.Addr, rec)
+	defer db.Close()
+
+	expected, err := session(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadEntries(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries, expected
+}
+
+func TestReplay(t *testing.T) {
+	entries, expected := record(t)
+	if len(entries) == 0 || entries[0].Method != "OpenSession" {
+		t.Fatalf("unexpected recording: %v", entries)
+	}
+
+	srv, err := NewServer(entries, HiveServer2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	db := open(t, srv.Addr, nil)
+	defer db.Close()
+
+	actual, err := session(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got: %q, want: %q", actual, expected)
+	}
+	if err := srv.Err(); err != nil {
+		t.Error(err)
+	}
+	if n := srv.Remaining(); n != 0 {
+		t.Errorf("%d entries were not replayed", n)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	entries, _ := record(t)
+
+	srv, err := NewServer(entries, HiveServer2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	db := open(t, srv.Addr, nil)
+	defer db.Close()
+
+	if _, err := db.Exec("TRUNCATE users"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := srv.Err(); err == nil || !strings.Contains(err.Error(), "TRUNCATE users") {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/services/cli_service"
+)
+
+// Service maps method names to constructors of call args and result
+type Service map[string]func() (args, result thrift.TStruct)
+
+// HiveServer2 is TCLIService
+var HiveServer2 = Service{
+	"OpenSession": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceOpenSessionArgs(), cli_service.NewTCLIServiceOpenSessionResult()
+	},
+	"CloseSession": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceCloseSessionArgs(), cli_service.NewTCLIServiceCloseSessionResult()
+	},
+	"GetInfo": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetInfoArgs(), cli_service.NewTCLIServiceGetInfoResult()
+	},
+	"ExecuteStatement": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceExecuteStatementArgs(), cli_service.NewTCLIServiceExecuteStatementResult()
+	},
+	"GetTypeInfo": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetTypeInfoArgs(), cli_service.NewTCLIServiceGetTypeInfoResult()
+	},
+	"GetCatalogs": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetCatalogsArgs(), cli_service.NewTCLIServiceGetCatalogsResult()
+	},
+	"GetSchemas": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetSchemasArgs(), cli_service.NewTCLIServiceGetSchemasResult()
+	},
+	"GetTables": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetTablesArgs(), cli_service.NewTCLIServiceGetTablesResult()
+	},
+	"GetTableTypes": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetTableTypesArgs(), cli_service.NewTCLIServiceGetTableTypesResult()
+	},
+	"GetColumns": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetColumnsArgs(), cli_service.NewTCLIServiceGetColumnsResult()
+	},
+	"GetFunctions": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetFunctionsArgs(), cli_service.NewTCLIServiceGetFunctionsResult()
+	},
+	"GetOperationStatus": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetOperationStatusArgs(), cli_service.NewTCLIServiceGetOperationStatusResult()
+	},
+	"CancelOperation": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceCancelOperationArgs(), cli_service.NewTCLIServiceCancelOperationResult()
+	},
+	"CloseOperation": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceCloseOperationArgs(), cli_service.NewTCLIServiceCloseOperationResult()
+	},
+	"GetResultSetMetadata": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetResultSetMetadataArgs(), cli_service.NewTCLIServiceGetResultSetMetadataResult()
+	},
+	"FetchResults": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceFetchResultsArgs(), cli_service.NewTCLIServiceFetchResultsResult()
+	},
+	"GetDelegationToken": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetDelegationTokenArgs(), cli_service.NewTCLIServiceGetDelegationTokenResult()
+	},
+	"CancelDelegationToken": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceCancelDelegationTokenArgs(), cli_service.NewTCLIServiceCancelDelegationTokenResult()
+	},
+	"RenewDelegationToken": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceRenewDelegationTokenArgs(), cli_service.NewTCLIServiceRenewDelegationTokenResult()
+	},
+	"GetLog": func() (thrift.TStruct, thrift.TStruct) {
+		return cli_service.NewTCLIServiceGetLogArgs(), cli_service.NewTCLIServiceGetLogResult()
+	},
+}
+
+// Server replays recorded responses in order. Calls which do not match
+// the next recorded method and args fail with application exception
+type Server struct {
+	// Addr is host:port server listens on
+	Addr string
+
+	svc      Service
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	entries []Entry
+	next    int
+	err     error
+}
+
+// NewServer starts server replaying entries on random port of 127.0.0.1
+func NewServer(entries []Entry, svc Service) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:     l.Addr().String(),
+		svc:      svc,
+		listener: l,
+		conns:    make(map[net.Conn]struct{}),
+		entries:  entries,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Remaining returns number of entries not replayed yet
+func (s *Server) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries) - s.next
+}
+
+// Err returns first mismatch between calls and recording
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops server and closes client connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c)
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer c.Close()
+
+	ctx := context.Background()
+	transport := thrift.NewTBufferedTransport(thrift.NewTSocketFromConnTimeout(c, 0), 4096)
+	p := thrift.NewTBinaryProtocol(transport, false, true)
+
+	for {
+		name, _, seq, err := p.ReadMessageBegin()
+		if err != nil {
+			return
+		}
+
+		newfn, ok := s.svc[name]
+		if !ok {
+			if err := p.Skip(thrift.STRUCT); err != nil {
+				return
+			}
+			p.ReadMessageEnd()
+			s.fail(fmt.Errorf("recording: unknown method %s", name))
+			if err := writeException(ctx, p, name, seq, thrift.UNKNOWN_METHOD, "unknown method "+name); err != nil {
+				return
+			}
+			continue
+		}
+
+		args, result := newfn()
+		if err := args.Read(p); err != nil {
+			return
+		}
+		p.ReadMessageEnd()
+
+		entry, err := s.replay(name, args)
+		if err != nil {
+			s.fail(err)
+			if err := writeException(ctx, p, name, seq, thrift.INTERNAL_ERROR, err.Error()); err != nil {
+				return
+			}
+			continue
+		}
+		if entry.Error != "" {
+			// recorded call failed in transport, close connection likewise
+			return
+		}
+
+		if err := json.Unmarshal(entry.Result, result); err != nil {
+			s.fail(err)
+			return
+		}
+		if err := p.WriteMessageBegin(name, thrift.REPLY, seq); err != nil {
+			return
+		}
+		if err := result.Write(p); err != nil {
+			return
+		}
+		if err := p.WriteMessageEnd(); err != nil {
+			return
+		}
+		if err := p.Flush(ctx); err != nil {
+			return
+		}
+	}
+}
+
+// replay returns next entry if it matches the call
+func (s *Server) replay(method string, args thrift.TStruct) (*Entry, error) {
+	actual, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next >= len(s.entries) {
+		return nil, fmt.Errorf("recording: unexpected call %s %s after end of recording", method, actual)
+	}
+
+	entry := &s.entries[s.next]
+	var expected bytes.Buffer
+	if err := json.Compact(&expected, entry.Args); err != nil {
+		return nil, err
+	}
+	if entry.Method != method || !bytes.Equal(expected.Bytes(), actual) {
+		return nil, fmt.Errorf("recording: call %d: got %s %s, want %s %s", s.next+1, method, actual, entry.Method, expected.Bytes())
+	}
+
+	s.next++
+	return entry, nil
+}
+
+func (s *Server) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func writeException(ctx context.Context, p thrift.TProtocol, name string, seq int32, typ int32, msg string) error {
+	exc := thrift.NewTApplicationException(typ, msg)
+	if err := p.WriteMessageBegin(name, thrift.EXCEPTION, seq); err != nil {
+		return err
+	}
+	if err := exc.Write(p); err != nil {
+		return err
+	}
+	if err := p.WriteMessageEnd(); err != nil {
+		return err
+	}
+	return p.Flush(ctx)
+}
@@ -0,0 +1,226 @@
+package impala
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/beeswax"
+	"github.com/bippio/go-impala/hive"
+)
+
+// RetryPolicy retries transient failures with exponential backoff.
+// Connection refusals and resets are retried when connecting. Invalid handles
+// after coordinator restarts and admission queue rejections are retried for
+// statements which are read-only or marked with WithIdempotent
+type RetryPolicy struct {
+	// MaxAttempts is total number of attempts. Values below 2 disable retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each backoff by up to the given fraction, from 0 to 1
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used when retries are enabled by DSN
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// backoff returns delay before next attempt after the given attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// do calls fn until it succeeds, fails with error which is not retryable,
+// attempts are exhausted or ctx is done. Nil policy calls fn once
+func (p *RetryPolicy) do(ctx context.Context, fn func() error, retryable func(error) bool) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || p == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks statements executed with ctx as safe to retry
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// idempotent reports whether stmt can be retried
+func idempotent(ctx context.Context, stmt string) bool {
+	if v, _ := ctx.Value(idempotentKey{}).(bool); v {
+		return true
+	}
+	return readOnly(stmt)
+}
+
+// readOnly reports whether stmt is SELECT, SHOW or DESCRIBE
+func readOnly(stmt string) bool {
+	stmt = skipComments(stmt)
+	end := strings.IndexFunc(stmt, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end == -1 {
+		end = len(stmt)
+	}
+	switch strings.ToUpper(stmt[:end]) {
+	case "SELECT", "SHOW", "DESCRIBE", "DESC":
+		return true
+	}
+	return false
+}
+
+// skipComments trims leading whitespace, parentheses and comments
+func skipComments(stmt string) string {
+	for {
+		stmt = strings.TrimLeft(stmt, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(stmt, "--"):
+			end := strings.IndexByte(stmt, '\n')
+			if end == -1 {
+				return ""
+			}
+			stmt = stmt[end+1:]
+		case strings.HasPrefix(stmt, "/*"):
+			end := strings.Index(stmt, "*/")
+			if end == -1 {
+				return ""
+			}
+			stmt = stmt[end+2:]
+		default:
+			return stmt
+		}
+	}
+}
+
+// isConnectionError reports whether err is connection refusal, reset or close by peer
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var te thrift.TTransportException
+	if errors.As(err, &te) {
+		if te.TypeId() == thrift.END_OF_FILE {
+			return true
+		}
+		if inner := te.Err(); inner != nil && inner != err && isConnectionError(inner) {
+			return true
+		}
+	}
+
+	// thrift sockets keep only the message of dial errors
+	msg := err.Error()
+	return strings.Contains(msg, "connection refused") || strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "broken pipe")
+}
+
+// isBroken reports whether err leaves connection in unknown state,
+// so that it must not be reused
+func isBroken(err error) bool {
+	if isConnectionError(err) || isTimeout(err) {
+		return true
+	}
+	var te thrift.TTransportException
+	var pe thrift.TProtocolException
+	return errors.As(err, &te) || errors.As(err, &pe)
+}
+
+// isTimeout reports whether socket timeout expired. Deadline of context is
+// not socket timeout
+func isTimeout(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var te thrift.TTransportException
+	if errors.As(err, &te) && te.TypeId() == thrift.TIMED_OUT {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// badConn replaces socket timeout of established connection with
+// driver.ErrBadConn, so that database/sql discards the connection, whose
+// state is unknown, and retries on a new one
+func badConn(err error) error {
+	if isTimeout(err) {
+		return driver.ErrBadConn
+	}
+	return err
+}
+
+// isInvalidHandle reports whether server lost session or operation, e.g. after coordinator restart
+func isInvalidHandle(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, hive.ErrInvalidHandle) || errors.Is(err, beeswax.ErrQueryNotFound) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Invalid session id") || strings.Contains(msg, "Invalid query handle")
+}
+
+// isAdmissionRejected reports whether query was rejected by admission control
+func isAdmissionRejected(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Rejected query from pool")
+}
+
+func isStatementRetryable(err error) bool {
+	return isInvalidHandle(err) || isAdmissionRejected(err)
+}
+
+// retryStatement runs fn under retry policy if stmt is idempotent.
+// Connection failures of idempotent statements are reported as driver.ErrBadConn,
+// so that database/sql retries them on a new connection
+func retryStatement(ctx context.Context, p *RetryPolicy, stmt string, fn func() error) error {
+	if p == nil || !idempotent(ctx, stmt) {
+		return fn()
+	}
+
+	err := p.do(ctx, fn, isStatementRetryable)
+	if isConnectionError(err) && ctx.Err() == nil {
+		return driver.ErrBadConn
+	}
+	return err
+}
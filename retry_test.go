@@ -0,0 +1,149 @@
+package impala
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/bippio/go-impala/hive"
+)
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		readOnly bool
+	}{
+		{stmt: "SELECT 1", readOnly: true},
+		{stmt: "  select * from t", readOnly: true},
+		{stmt: "(SELECT 1) UNION (SELECT 2)", readOnly: true},
+		{stmt: "/* tag */ SHOW TABLES", readOnly: true},
+		{stmt: "-- comment\nDESCRIBE t", readOnly: true},
+		{stmt: "desc t", readOnly: true},
+		{stmt: "INSERT INTO t SELECT 1", readOnly: false},
+		{stmt: "SELECTED", readOnly: false},
+		{stmt: "/* SELECT */ DROP TABLE t", readOnly: false},
+		{stmt: "", readOnly: false},
+	}
+
+	for _, tt := range tests {
+		if actual := readOnly(tt.stmt); actual != tt.readOnly {
+			t.Errorf("readOnly(%q) = %v, want %v", tt.stmt, actual, tt.readOnly)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	ctx := context.Background()
+	if idempotent(ctx, "INSERT INTO t VALUES (1)") {
+		t.Error("insert should not be idempotent")
+	}
+	if !idempotent(WithIdempotent(ctx), "INSERT INTO t VALUES (1)") {
+		t.Error("insert marked by context should be idempotent")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, d := range expected {
+		if actual := p.backoff(i + 1); actual != d {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, actual, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("backoff with jitter = %v, want within 50ms..150ms", d)
+		}
+	}
+}
+
+func TestRetryErrors(t *testing.T) {
+	tests := []struct {
+		err        error
+		connection bool
+		statement  bool
+	}{
+		{err: thrift.NewTTransportException(thrift.NOT_OPEN, "dial tcp 127.0.0.1:21050: connect: connection refused"), connection: true},
+		{err: fmt.Errorf("sasl: negotiation failed. %w", io.EOF), connection: true},
+		{err: thrift.NewTTransportExceptionFromError(io.EOF), connection: true},
+		{err: hive.ErrInvalidHandle, statement: true},
+		{err: errors.New("Invalid session id: 1234:5678"), statement: true},
+		{err: errors.New("Rejected query from pool root.default: queue full, limit=200, num_queued=200."), statement: true},
+		{err: errors.New("AnalysisException: Could not resolve table reference: 't'")},
+	}
+
+	for _, tt := range tests {
+		if actual := isConnectionError(tt.err); actual != tt.connection {
+			t.Errorf("isConnectionError(%v) = %v, want %v", tt.err, actual, tt.connection)
+		}
+		if actual := isStatementRetryable(tt.err); actual != tt.statement {
+			t.Errorf("isStatementRetryable(%v) = %v, want %v", tt.err, actual, tt.statement)
+		}
+	}
+}
+
+func TestRetryStatement(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	ctx := context.Background()
+	rejected := errors.New("Rejected query from pool root.default: queue full")
+
+	tests := []struct {
+		stmt     string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{stmt: "SELECT 1", errs: []error{rejected, nil}, attempts: 2},
+		{stmt: "SELECT 1", errs: []error{rejected, rejected, rejected}, attempts: 3, err: rejected},
+		{stmt: "INSERT INTO t VALUES (1)", errs: []error{rejected}, attempts: 1, err: rejected},
+		{stmt: "SELECT 1", errs: []error{io.EOF}, attempts: 1, err: driver.ErrBadConn},
+		{stmt: "INSERT INTO t VALUES (1)", errs: []error{io.EOF}, attempts: 1, err: io.EOF},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		err := retryStatement(ctx, p, tt.stmt, func() error {
+			err := tt.errs[attempts]
+			attempts++
+			return err
+		})
+		if attempts != tt.attempts {
+			t.Errorf("%s %v: attempts = %d, want %d", tt.stmt, tt.errs, attempts, tt.attempts)
+		}
+		if err != tt.err {
+			t.Errorf("%s %v: err = %v, want %v", tt.stmt, tt.errs, err, tt.err)
+		}
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	tests := []struct {
+		err     error
+		timeout bool
+	}{
+		{err: thrift.NewTTransportException(thrift.TIMED_OUT, "i/o timeout"), timeout: true},
+		{err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, timeout: true},
+		{err: context.DeadlineExceeded},
+		{err: fmt.Errorf("impala: SASL negotiation interrupted: %w", context.DeadlineExceeded)},
+		{err: io.EOF},
+		{err: nil},
+	}
+
+	for _, tt := range tests {
+		if actual := isTimeout(tt.err); actual != tt.timeout {
+			t.Errorf("isTimeout(%v) = %v, want %v", tt.err, actual, tt.timeout)
+		}
+	}
+	if err := badConn(tests[0].err); err != driver.ErrBadConn {
+		t.Errorf("badConn = %v, want ErrBadConn", err)
+	}
+}
@@ -2,21 +2,33 @@ package impala
 
 import (
 	"database/sql/driver"
+	"io"
 	"reflect"
 
 	"github.com/bippio/go-impala/hive"
 )
 
+// resultSet is implemented by result sets of every supported protocol
+type resultSet interface {
+	Next(dest []driver.Value) error
+}
+
 // Rows is an iterator over an executed query's results.
 type Rows struct {
-	rs      *hive.ResultSet
+	rs      resultSet
 	schema  *hive.TableSchema
 	closefn func() error
+	// errfn is notified about errors of fetching rows
+	errfn func(error)
 }
 
 // Close closes rows iterator
 func (r *Rows) Close() error {
-	return r.closefn()
+	err := r.closefn()
+	if err != nil && r.errfn != nil {
+		r.errfn(err)
+	}
+	return err
 }
 
 // Columns returns the names of the columns
@@ -40,5 +52,9 @@ func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
 
 // Next prepares next row for scanning
 func (r *Rows) Next(dest []driver.Value) error {
-	return r.rs.Next(dest)
+	err := r.rs.Next(dest)
+	if err != nil && err != io.EOF && r.errfn != nil {
+		r.errfn(err)
+	}
+	return err
 }
@@ -5,7 +5,9 @@ import (
 )
 
 var supported = map[string]func(*Options) mech{
-	MechPlain: newPlain,
+	MechPlain:     newPlain,
+	MechGSSAPI:    newGSSAPI,
+	MechDigestMD5: newDigestMD5,
 }
 
 // NewClient created new sasl client
@@ -29,11 +31,29 @@ func (c *client) Step(challenge []byte) ([]byte, bool, error) {
 	return c.m.Step(challenge)
 }
 
+func (c *client) QOP() QOP {
+	if c.m == nil {
+		return QOPAuth
+	}
+	return c.m.QOP()
+}
+
+func (c *client) Wrap(b []byte) ([]byte, error) {
+	return c.m.Wrap(b)
+}
+
+func (c *client) Unwrap(b []byte) ([]byte, error) {
+	return c.m.Unwrap(b)
+}
+
 func (c *client) Free() {}
 
 type mech interface {
 	Start() (mech string, initial []byte, done bool, err error)
 	Step(challenge []byte) (response []byte, done bool, err error)
+	QOP() QOP
+	Wrap(b []byte) ([]byte, error)
+	Unwrap(b []byte) ([]byte, error)
 }
 
 type client struct {
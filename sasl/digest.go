@@ -0,0 +1,322 @@
+package sasl
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// digestMD5 implements DIGEST-MD5 mechanism of RFC 2831 with auth, auth-int
+// and auth-conf with rc4 cipher
+type digestMD5 struct {
+	opts   *Options
+	step   int
+	cnonce string
+
+	// values of the first challenge and response needed to verify rspauth
+	nonce  string
+	realm  string
+	uri    string
+	ha1    []byte
+	qop    QOP
+	layer  *digestLayer
+	secure bool
+}
+
+// Magic constants of key derivation in RFC 2831
+const (
+	clientSignMagic = "Digest session key to client-to-server signing key magic constant"
+	serverSignMagic = "Digest session key to server-to-client signing key magic constant"
+	clientSealMagic = "Digest H(A1) to client-to-server sealing key magic constant"
+	serverSealMagic = "Digest H(A1) to server-to-client sealing key magic constant"
+
+	digestNC     = "00000001"
+	digestCipher = "rc4"
+	digestMaxBuf = 65536
+)
+
+func newDigestMD5(opts *Options) mech {
+	return &digestMD5{opts: opts}
+}
+
+func (m *digestMD5) Start() (string, []byte, bool, error) {
+	return MechDigestMD5, nil, false, nil
+}
+
+func (m *digestMD5) Step(challenge []byte) ([]byte, bool, error) {
+	m.step++
+	switch m.step {
+	case 1:
+		response, err := m.respond(challenge)
+		if err != nil {
+			return nil, false, err
+		}
+		return response, false, nil
+	case 2:
+		if err := m.verify(challenge); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	}
+	return nil, false, ErrUnexpectedServerChallenge
+}
+
+// respond computes response to digest challenge of server
+func (m *digestMD5) respond(challenge []byte) ([]byte, error) {
+	directives, err := parseDirectives(string(challenge))
+	if err != nil {
+		return nil, err
+	}
+	if alg := directives["algorithm"]; alg != "md5-sess" {
+		return nil, fmt.Errorf("sasl: unsupported digest algorithm %q", alg)
+	}
+	m.nonce = directives["nonce"]
+	if m.nonce == "" {
+		return nil, errors.New("sasl: digest challenge without nonce")
+	}
+	m.realm = directives["realm"]
+
+	offered := map[QOP]bool{}
+	for _, s := range strings.Split(directives["qop"], ",") {
+		if q, err := ParseQOP(strings.TrimSpace(s)); err == nil {
+			offered[q] = true
+		}
+	}
+	if len(offered) == 0 {
+		offered[QOPAuth] = true
+	}
+	// only rc4 cipher is supported for confidentiality
+	if !hasToken(directives["cipher"], digestCipher) {
+		delete(offered, QOPConfidentiality)
+	}
+
+	accepted := m.opts.QOP
+	if len(accepted) == 0 {
+		accepted = []QOP{QOPConfidentiality, QOPIntegrity, QOPAuth}
+	}
+	for _, q := range accepted {
+		if offered[q] {
+			m.qop = q
+			break
+		}
+	}
+	if m.qop == 0 {
+		return nil, fmt.Errorf("sasl: server does not support any of accepted qop %v", accepted)
+	}
+
+	if m.cnonce == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		m.cnonce = base64.StdEncoding.EncodeToString(b)
+	}
+	m.uri = m.opts.Service + "/" + m.opts.Host
+
+	secret := md5.Sum([]byte(m.opts.Username + ":" + m.realm + ":" + m.opts.Password))
+	m.ha1 = md5sum(string(secret[:]) + ":" + m.nonce + ":" + m.cnonce)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "charset=utf-8,username=%s,realm=%s,nonce=%s,nc=%s,cnonce=%s,digest-uri=%s,maxbuf=%d,response=%s,qop=%s",
+		quote(m.opts.Username), quote(m.realm), quote(m.nonce), digestNC, quote(m.cnonce), quote(m.uri),
+		digestMaxBuf, m.digest("AUTHENTICATE"), m.qop)
+	if m.qop == QOPConfidentiality {
+		b.WriteString(",cipher=" + digestCipher)
+	}
+	return []byte(b.String()), nil
+}
+
+// digest computes response value for method, which is empty for rspauth
+func (m *digestMD5) digest(method string) string {
+	a2 := method + ":" + m.uri
+	if m.qop != QOPAuth {
+		a2 += ":00000000000000000000000000000000"
+	}
+	kd := hex.EncodeToString(m.ha1) + ":" + m.nonce + ":" + digestNC + ":" + m.cnonce + ":" + m.qop.String() + ":" + hex.EncodeToString(md5sum(a2))
+	return hex.EncodeToString(md5sum(kd))
+}
+
+// verify checks rspauth of server and establishes security layer
+func (m *digestMD5) verify(challenge []byte) error {
+	directives, err := parseDirectives(string(challenge))
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(directives["rspauth"]), []byte(m.digest(""))) {
+		return errors.New("sasl: server failed digest authentication")
+	}
+
+	if m.qop != QOPAuth {
+		m.layer, err = newDigestLayer(m.ha1, m.qop, false)
+		if err != nil {
+			return err
+		}
+	}
+	m.secure = true
+	return nil
+}
+
+func (m *digestMD5) QOP() QOP {
+	if !m.secure {
+		return QOPAuth
+	}
+	return m.qop
+}
+
+func (m *digestMD5) Wrap(b []byte) ([]byte, error) {
+	if m.QOP() == QOPAuth {
+		return b, nil
+	}
+	return m.layer.wrap(b), nil
+}
+
+func (m *digestMD5) Unwrap(b []byte) ([]byte, error) {
+	if m.QOP() == QOPAuth {
+		return b, nil
+	}
+	return m.layer.unwrap(b)
+}
+
+// digestLayer protects messages after DIGEST-MD5 authentication
+type digestLayer struct {
+	sendKey, recvKey       []byte
+	sendCipher, recvCipher *rc4.Cipher
+	sendSeq, recvSeq       uint32
+}
+
+// newDigestLayer derives keys of security layer from H(A1)
+func newDigestLayer(ha1 []byte, qop QOP, server bool) (*digestLayer, error) {
+	sign := func(magic string) []byte { return md5sum(string(ha1) + magic) }
+	l := &digestLayer{sendKey: sign(clientSignMagic), recvKey: sign(serverSignMagic)}
+	if server {
+		l.sendKey, l.recvKey = l.recvKey, l.sendKey
+	}
+
+	if qop == QOPConfidentiality {
+		sendCipher, err := rc4.NewCipher(md5sum(string(ha1) + clientSealMagic))
+		if err != nil {
+			return nil, err
+		}
+		recvCipher, err := rc4.NewCipher(md5sum(string(ha1) + serverSealMagic))
+		if err != nil {
+			return nil, err
+		}
+		if server {
+			sendCipher, recvCipher = recvCipher, sendCipher
+		}
+		l.sendCipher, l.recvCipher = sendCipher, recvCipher
+	}
+	return l, nil
+}
+
+func (l *digestLayer) mac(key []byte, seq uint32, msg []byte) []byte {
+	h := hmac.New(md5.New, key)
+	binary.Write(h, binary.BigEndian, seq)
+	h.Write(msg)
+	return h.Sum(nil)[:10]
+}
+
+// wrap returns message followed by MAC, or encrypted, and by type and sequence number
+func (l *digestLayer) wrap(msg []byte) []byte {
+	out := make([]byte, 0, len(msg)+16)
+	out = append(out, msg...)
+	out = append(out, l.mac(l.sendKey, l.sendSeq, msg)...)
+	if l.sendCipher != nil {
+		l.sendCipher.XORKeyStream(out, out)
+	}
+	out = append(out, 0, 1, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(out[len(out)-4:], l.sendSeq)
+	l.sendSeq++
+	return out
+}
+
+func (l *digestLayer) unwrap(b []byte) ([]byte, error) {
+	if len(b) < 16 || b[len(b)-6] != 0 || b[len(b)-5] != 1 {
+		return nil, errors.New("sasl: malformed digest message")
+	}
+	if seq := binary.BigEndian.Uint32(b[len(b)-4:]); seq != l.recvSeq {
+		return nil, fmt.Errorf("sasl: digest message out of sequence: %d, expected %d", seq, l.recvSeq)
+	}
+
+	body := append([]byte{}, b[:len(b)-6]...)
+	if l.recvCipher != nil {
+		l.recvCipher.XORKeyStream(body, body)
+	}
+	msg, mac := body[:len(body)-10], body[len(body)-10:]
+	if !hmac.Equal(mac, l.mac(l.recvKey, l.recvSeq, msg)) {
+		return nil, errors.New("sasl: digest message integrity check failed")
+	}
+	l.recvSeq++
+	return msg, nil
+}
+
+func md5sum(s string) []byte {
+	h := md5.Sum([]byte(s))
+	return h[:]
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// hasToken reports whether comma separated list contains token
+func hasToken(list, token string) bool {
+	for _, s := range strings.Split(list, ",") {
+		if strings.TrimSpace(s) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDirectives parses comma separated name=value pairs of digest
+// challenge. Values may be quoted. The first value of repeated name is kept
+func parseDirectives(s string) (map[string]string, error) {
+	directives := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return directives, nil
+		}
+
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("sasl: malformed digest directive %q", s)
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i = 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("sasl: unterminated digest directive %s", name)
+			}
+			s = s[i+1:]
+		} else {
+			i = strings.IndexByte(s, ',')
+			if i < 0 {
+				i = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:i]))
+			s = s[i:]
+		}
+
+		if _, ok := directives[name]; !ok {
+			directives[name] = value.String()
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package sasl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDigestMD5(t *testing.T) {
+	// example of RFC 2831 section 4
+	m := &digestMD5{
+		opts: &Options{
+			Service:  "imap",
+			Host:     "elwood.innosoft.com",
+			Username: "chris",
+			Password: "secret",
+		},
+		cnonce: "OA6MHXh6VqTrRk",
+	}
+	if _, _, done, err := m.Start(); err != nil || done {
+		t.Fatalf("start: done %v, err %v", done, err)
+	}
+
+	response, done, err := m.Step([]byte(`realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`))
+	if err != nil || done {
+		t.Fatalf("step 1: done %v, err %v", done, err)
+	}
+	directives, err := parseDirectives(string(response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"username":   "chris",
+		"realm":      "elwood.innosoft.com",
+		"nonce":      "OA6MG9tEQGm2hh",
+		"cnonce":     "OA6MHXh6VqTrRk",
+		"nc":         "00000001",
+		"qop":        "auth",
+		"digest-uri": "imap/elwood.innosoft.com",
+		"response":   "d388dad90d4bbd760a152321f2143af7",
+	}
+	for name, value := range expected {
+		if directives[name] != value {
+			t.Errorf("%s = %q, want %q", name, directives[name], value)
+		}
+	}
+
+	if _, _, err := m.Step([]byte("rspauth=00000000000000000000000000000000")); err == nil {
+		t.Error("expected error for wrong rspauth")
+	}
+	m.step = 1
+	if _, done, err := m.Step([]byte("rspauth=ea40f60335c427b5527b84dbabcdfffd")); err != nil || !done {
+		t.Fatalf("step 2: done %v, err %v", done, err)
+	}
+	if m.QOP() != QOPAuth {
+		t.Errorf("qop = %s, want auth", m.QOP())
+	}
+}
+
+func TestDigestMD5Challenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		accepted  []QOP
+		qop       QOP
+		err       string
+	}{
+		{"confidentiality", `nonce="n",qop="auth,auth-int,auth-conf",cipher="rc4,3des",algorithm=md5-sess`, nil, QOPConfidentiality, ""},
+		{"no rc4", `nonce="n",qop="auth,auth-int,auth-conf",cipher="3des",algorithm=md5-sess`, nil, QOPIntegrity, ""},
+		{"default qop", `nonce="n",algorithm=md5-sess`, nil, QOPAuth, ""},
+		{"preference", `nonce="n",qop="auth,auth-int",algorithm=md5-sess`, []QOP{QOPAuth, QOPIntegrity}, QOPAuth, ""},
+		{"no common qop", `nonce="n",qop="auth",algorithm=md5-sess`, []QOP{QOPIntegrity}, 0, "server does not support any of accepted qop [auth-int]"},
+		{"algorithm", `nonce="n",algorithm=md5`, nil, 0, "unsupported digest algorithm"},
+		{"no nonce", `algorithm=md5-sess`, nil, 0, "without nonce"},
+		{"unterminated", `nonce="n,algorithm=md5-sess`, nil, 0, "unterminated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &digestMD5{opts: &Options{QOP: tt.accepted}}
+			response, _, err := m.Step([]byte(tt.challenge))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.qop != tt.qop {
+				t.Errorf("qop = %s, want %s", m.qop, tt.qop)
+			}
+			if cipher := strings.Contains(string(response), "cipher=rc4"); cipher != (tt.qop == QOPConfidentiality) {
+				t.Errorf("cipher in response %q", response)
+			}
+		})
+	}
+}
+
+func TestDigestLayer(t *testing.T) {
+	ha1 := md5sum("secret")
+	for _, qop := range []QOP{QOPIntegrity, QOPConfidentiality} {
+		client, err := newDigestLayer(ha1, qop, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := newDigestLayer(ha1, qop, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, msg := range []string{"hello", "world"} {
+			wrapped := client.wrap([]byte(msg))
+			if encrypted := !bytes.Contains(wrapped, []byte(msg)); encrypted != (qop == QOPConfidentiality) {
+				t.Errorf("%s: message encrypted %v", qop, encrypted)
+			}
+			got, err := server.unwrap(wrapped)
+			if err != nil {
+				t.Fatalf("%s: %v", qop, err)
+			}
+			if string(got) != msg {
+				t.Errorf("%s: got %q, want %q", qop, got, msg)
+			}
+
+			got, err = client.unwrap(server.wrap(bytes.ToUpper(got)))
+			if err != nil {
+				t.Fatalf("%s: %v", qop, err)
+			}
+			if expected := strings.ToUpper(msg); string(got) != expected {
+				t.Errorf("%s: got %q, want %q", qop, got, expected)
+			}
+		}
+
+		// replayed message is out of sequence
+		wrapped := client.wrap([]byte("again"))
+		if _, err := server.unwrap(wrapped); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.unwrap(wrapped); err == nil {
+			t.Errorf("%s: expected sequence error", qop)
+		}
+
+		// messages are accepted only from peer
+		if _, err := client.unwrap(client.wrap([]byte("self"))); err == nil {
+			t.Errorf("%s: expected integrity error", qop)
+		}
+	}
+
+	l, _ := newDigestLayer(ha1, QOPIntegrity, true)
+	tampered := (&digestLayer{sendKey: l.recvKey}).wrap([]byte("payload"))
+	tampered[0] ^= 1
+	if _, err := l.unwrap(tampered); err == nil {
+		t.Error("expected error for tampered message")
+	}
+}
+
+func TestDelegationToken(t *testing.T) {
+	token := &DelegationToken{
+		Identifier: bytes.Repeat([]byte{0xab}, 300),
+		Password:   []byte("password"),
+		Kind:       "HIVE_DELEGATION_TOKEN",
+	}
+	parsed, err := ParseDelegationToken(token.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Identifier, token.Identifier) || string(parsed.Password) != "password" ||
+		parsed.Kind != token.Kind || parsed.Service != "" {
+		t.Errorf("got %+v", parsed)
+	}
+	if user, password := parsed.Credentials(); password != "cGFzc3dvcmQ=" || !strings.HasPrefix(user, "q6ur") {
+		t.Errorf("credentials %q %q", user, password)
+	}
+
+	// padded form is accepted
+	if _, err := ParseDelegationToken(token.String() + "=="); err != nil {
+		t.Error(err)
+	}
+	for _, s := range []string{"!", "AAAA", token.String()[:20], token.String() + "AA"} {
+		if _, err := ParseDelegationToken(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package sasl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// maxBufferSize is the largest buffer size of GSSAPI security layer
+const maxBufferSize = 1<<24 - 1
+
+// gssapiMech implements GSSAPI mechanism of RFC 4752 with Kerberos V5
+type gssapiMech struct {
+	opts  *Options
+	step  int
+	auth  types.Authenticator
+	ctx   *securityContext
+	qop   QOP
+	ready bool
+}
+
+func newGSSAPI(opts *Options) mech {
+	return &gssapiMech{opts: opts}
+}
+
+func (m *gssapiMech) Start() (string, []byte, bool, error) {
+	cl := m.opts.KerberosClient
+	if cl == nil {
+		return "", nil, false, errors.New("sasl: GSSAPI requires kerberos client")
+	}
+
+	spn := m.opts.Service + "/" + m.opts.Host
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("sasl: failed to get service ticket for %s: %w", spn, err)
+	}
+
+	token, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key,
+		[]int{gssapi.ContextFlagMutual, gssapi.ContextFlagInteg, gssapi.ContextFlagConf},
+		[]int{flags.APOptionMutualRequired})
+	if err != nil {
+		return "", nil, false, err
+	}
+	// authenticator is needed to verify reply of server and for sequence numbers
+	if err := token.APReq.DecryptAuthenticator(key); err != nil {
+		return "", nil, false, err
+	}
+	m.auth = token.APReq.Authenticator
+	m.ctx = &securityContext{key: key, seq: uint64(m.auth.SeqNumber)}
+
+	initial, err := token.Marshal()
+	if err != nil {
+		return "", nil, false, err
+	}
+	return MechGSSAPI, initial, false, nil
+}
+
+func (m *gssapiMech) Step(challenge []byte) ([]byte, bool, error) {
+	m.step++
+	switch m.step {
+	case 1:
+		if err := m.verifyReply(challenge); err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	case 2:
+		response, err := m.negotiate(challenge)
+		if err != nil {
+			return nil, false, err
+		}
+		return response, true, nil
+	}
+	return nil, false, ErrUnexpectedServerChallenge
+}
+
+// verifyReply verifies AP-REP of mutual authentication
+func (m *gssapiMech) verifyReply(challenge []byte) error {
+	var token spnego.KRB5Token
+	if err := token.Unmarshal(challenge); err != nil {
+		return fmt.Errorf("sasl: invalid GSSAPI reply: %w", err)
+	}
+	if token.IsKRBError() {
+		return fmt.Errorf("sasl: %w", token.KRBError)
+	}
+	if !token.IsAPRep() {
+		return errors.New("sasl: GSSAPI reply is not AP-REP")
+	}
+
+	b, err := crypto.DecryptEncPart(token.APRep.EncPart, m.ctx.key, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return fmt.Errorf("sasl: failed to decrypt AP-REP: %w", err)
+	}
+	var part messages.EncAPRepPart
+	if err := part.Unmarshal(b); err != nil {
+		return err
+	}
+	if !part.CTime.Equal(m.auth.CTime) || part.Cusec != m.auth.Cusec {
+		return errors.New("sasl: AP-REP does not match authenticator")
+	}
+
+	if part.Subkey.KeyType != 0 {
+		m.ctx.key = part.Subkey
+		m.ctx.subkey = true
+	}
+	return nil
+}
+
+// negotiate selects security layer offered by server
+func (m *gssapiMech) negotiate(challenge []byte) ([]byte, error) {
+	offer, _, err := m.ctx.unwrap(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if len(offer) != 4 {
+		return nil, fmt.Errorf("sasl: invalid security layer offer of %d bytes", len(offer))
+	}
+
+	accepted := m.opts.QOP
+	if len(accepted) == 0 {
+		accepted = []QOP{QOPConfidentiality, QOPIntegrity, QOPAuth}
+	}
+	for _, q := range accepted {
+		if QOP(offer[0])&q != 0 {
+			m.qop = q
+			break
+		}
+	}
+	if m.qop == 0 {
+		return nil, fmt.Errorf("sasl: server does not support any of accepted qop %v", accepted)
+	}
+
+	size := uint32(0)
+	if m.qop != QOPAuth {
+		size = maxBufferSize
+		if m.opts.MaxFrameSize > 0 && m.opts.MaxFrameSize < maxBufferSize {
+			size = uint32(m.opts.MaxFrameSize)
+		}
+	}
+	response := make([]byte, 4)
+	binary.BigEndian.PutUint32(response, size)
+	response[0] = byte(m.qop)
+
+	wrapped, err := m.ctx.wrap(response, false)
+	if err != nil {
+		return nil, err
+	}
+	m.ready = true
+	return wrapped, nil
+}
+
+func (m *gssapiMech) QOP() QOP {
+	if !m.ready {
+		return QOPAuth
+	}
+	return m.qop
+}
+
+func (m *gssapiMech) Wrap(b []byte) ([]byte, error) {
+	if m.QOP() == QOPAuth {
+		return b, nil
+	}
+	return m.ctx.wrap(b, m.qop == QOPConfidentiality)
+}
+
+func (m *gssapiMech) Unwrap(b []byte) ([]byte, error) {
+	if m.QOP() == QOPAuth {
+		return b, nil
+	}
+	payload, sealed, err := m.ctx.unwrap(b)
+	if err != nil {
+		return nil, err
+	}
+	if m.qop == QOPConfidentiality && !sealed {
+		return nil, errors.New("sasl: message is not encrypted")
+	}
+	return payload, nil
+}
+
+// Flags of wrap token
+const (
+	flagSentByAcceptor = 0x01
+	flagSealed         = 0x02
+	flagAcceptorSubkey = 0x04
+)
+
+// securityContext wraps and unwraps messages with wrap tokens of RFC 4121
+type securityContext struct {
+	key types.EncryptionKey
+	// acceptor is set in context of server
+	acceptor bool
+	// subkey is set if key is subkey of acceptor
+	subkey bool
+	seq    uint64
+}
+
+func (c *securityContext) usage(sending bool) uint32 {
+	if c.acceptor == sending {
+		return keyusage.GSSAPI_ACCEPTOR_SEAL
+	}
+	return keyusage.GSSAPI_INITIATOR_SEAL
+}
+
+func (c *securityContext) wrap(payload []byte, seal bool) ([]byte, error) {
+	e, err := crypto.GetEtype(c.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags byte
+	if c.acceptor {
+		flags |= flagSentByAcceptor
+	}
+	if c.subkey {
+		flags |= flagAcceptorSubkey
+	}
+	seq := c.seq
+	c.seq++
+
+	if !seal {
+		token := gssapi.WrapToken{
+			Flags:     flags,
+			EC:        uint16(e.GetHMACBitLength() / 8),
+			SndSeqNum: seq,
+			Payload:   payload,
+		}
+		if err := token.SetCheckSum(c.key, c.usage(true)); err != nil {
+			return nil, err
+		}
+		return token.Marshal()
+	}
+
+	// encrypted part is payload followed by copy of header. No filler is
+	// needed as supported encryption types are not padded
+	header := make([]byte, gssapi.HdrLen)
+	copy(header, []byte{0x05, 0x04, flags | flagSealed, gssapi.FillerByte})
+	binary.BigEndian.PutUint64(header[8:], seq)
+
+	plain := make([]byte, 0, len(payload)+len(header))
+	plain = append(plain, payload...)
+	plain = append(plain, header...)
+	_, encrypted, err := e.EncryptMessage(c.key.KeyValue, plain, c.usage(true))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, encrypted...), nil
+}
+
+// unwrap returns payload of token and whether it was encrypted
+func (c *securityContext) unwrap(token []byte) ([]byte, bool, error) {
+	if len(token) < gssapi.HdrLen || token[0] != 0x05 || token[1] != 0x04 || token[3] != gssapi.FillerByte {
+		return nil, false, errors.New("sasl: malformed wrap token")
+	}
+	flags := token[2]
+	if (flags&flagSentByAcceptor != 0) == c.acceptor {
+		return nil, false, errors.New("sasl: wrap token sent in unexpected direction")
+	}
+
+	// data after header may be rotated right by RRC bytes
+	ec := int(binary.BigEndian.Uint16(token[4:6]))
+	data := token[gssapi.HdrLen:]
+	if rrc := int(binary.BigEndian.Uint16(token[6:8])); len(data) > 0 && rrc%len(data) != 0 {
+		rrc %= len(data)
+		data = append(append([]byte{}, data[rrc:]...), data[:rrc]...)
+	}
+
+	if flags&flagSealed == 0 {
+		b := make([]byte, 0, len(token))
+		b = append(b, token[:6]...)
+		b = append(b, 0, 0)
+		b = append(b, token[8:gssapi.HdrLen]...)
+		b = append(b, data...)
+
+		var wt gssapi.WrapToken
+		if err := wt.Unmarshal(b, !c.acceptor); err != nil {
+			return nil, false, fmt.Errorf("sasl: %w", err)
+		}
+		if _, err := wt.Verify(c.key, c.usage(false)); err != nil {
+			return nil, false, fmt.Errorf("sasl: %w", err)
+		}
+		return wt.Payload, false, nil
+	}
+
+	e, err := crypto.GetEtype(c.key.KeyType)
+	if err != nil {
+		return nil, false, err
+	}
+	plain, err := e.DecryptMessage(c.key.KeyValue, data, c.usage(false))
+	if err != nil {
+		return nil, false, fmt.Errorf("sasl: %w", err)
+	}
+	if len(plain) < gssapi.HdrLen+ec {
+		return nil, false, errors.New("sasl: malformed wrap token")
+	}
+	// encrypted header must match header of token except RRC
+	header := plain[len(plain)-gssapi.HdrLen:]
+	if !bytes.Equal(header[:6], token[:6]) || !bytes.Equal(header[8:], token[8:gssapi.HdrLen]) {
+		return nil, false, errors.New("sasl: wrap token header was modified")
+	}
+	return plain[:len(plain)-gssapi.HdrLen-ec], true, nil
+}
@@ -0,0 +1,347 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const realm = "EXAMPLE.COM"
+
+// kerberos returns keytab of service impala/localhost and client of alice
+// with service ticket in credentials cache, so that no KDC is needed
+func kerberos(t *testing.T) (*keytab.Keytab, *krb5.Client) {
+	kt := keytab.New()
+	now := time.Now().UTC()
+	for _, p := range []string{"impala/localhost", "krbtgt/" + realm} {
+		if err := kt.AddEntry(p, realm, "secret", now, 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "alice")
+	var cache bytes.Buffer
+	cache.Write([]byte{5, 4, 0, 0})
+	writePrincipal(&cache, cname)
+	for _, spn := range []string{"krbtgt/" + realm, "impala/localhost"} {
+		sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn)
+		tkt, key, err := messages.NewTicket(cname, realm, sname, realm, types.NewKrbFlags(), kt,
+			etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := tkt.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writePrincipal(&cache, cname)
+		writePrincipal(&cache, sname)
+		binary.Write(&cache, binary.BigEndian, uint16(key.KeyType))
+		writeData(&cache, key.KeyValue)
+		for _, ts := range []time.Time{now, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour)} {
+			binary.Write(&cache, binary.BigEndian, uint32(ts.Unix()))
+		}
+		// is_skey, ticket flags, addresses and authdata
+		cache.Write(make([]byte, 13))
+		writeData(&cache, b)
+		writeData(&cache, nil)
+	}
+
+	var cc credentials.CCache
+	if err := cc.Unmarshal(cache.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	cl, err := krb5.NewFromCCache(&cc, config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kt, cl
+}
+
+func writePrincipal(w *bytes.Buffer, p types.PrincipalName) {
+	binary.Write(w, binary.BigEndian, uint32(p.NameType))
+	binary.Write(w, binary.BigEndian, uint32(len(p.NameString)))
+	writeData(w, []byte(realm))
+	for _, s := range p.NameString {
+		writeData(w, []byte(s))
+	}
+}
+
+func writeData(w *bytes.Buffer, b []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(b)))
+	w.Write(b)
+}
+
+func readMessage(r io.Reader) (Status, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	_, err := io.ReadFull(r, body)
+	return Status(header[0]), body, err
+}
+
+// acceptor is server side of GSSAPI negotiation with mutual authentication
+// and acceptor subkey. It offers security layers in mask and echoes frames
+// in upper case
+func acceptor(conn net.Conn, kt *keytab.Keytab, mask byte) error {
+	if _, _, err := readMessage(conn); err != nil {
+		return err
+	}
+	_, initial, err := readMessage(conn)
+	if err != nil {
+		return err
+	}
+
+	var token spnego.KRB5Token
+	if err := token.Unmarshal(initial); err != nil {
+		return err
+	}
+	if ok, _, err := service.VerifyAPREQ(&token.APReq, service.NewSettings(kt)); !ok {
+		return fmt.Errorf("AP-REQ not verified: %v", err)
+	}
+
+	etype, err := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		return err
+	}
+	subkey, err := types.GenerateEncryptionKey(etype)
+	if err != nil {
+		return err
+	}
+	reply, err := apRep(token.APReq, subkey)
+	if err != nil {
+		return err
+	}
+	conn.Write(message(StatusOK, string(reply)))
+
+	if _, _, err := readMessage(conn); err != nil {
+		return err
+	}
+
+	ctx := &securityContext{key: subkey, acceptor: true, subkey: true}
+	offer, err := ctx.wrap([]byte{mask, 0, 0x10, 0}, false)
+	if err != nil {
+		return err
+	}
+	conn.Write(message(StatusOK, string(offer)))
+
+	_, response, err := readMessage(conn)
+	if err != nil {
+		return err
+	}
+	selected, _, err := ctx.unwrap(response)
+	if err != nil {
+		return err
+	}
+	qop := QOP(selected[0])
+	conn.Write(message(StatusComplete, ""))
+
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return err
+		}
+		if qop != QOPAuth {
+			var sealed bool
+			body, sealed, err = ctx.unwrap(body)
+			if err != nil {
+				return err
+			}
+			if sealed != (qop == QOPConfidentiality) {
+				return fmt.Errorf("frame sealed: %v with qop %s", sealed, qop)
+			}
+			body, err = ctx.wrap(bytes.ToUpper(body), sealed)
+			if err != nil {
+				return err
+			}
+		} else {
+			body = bytes.ToUpper(body)
+		}
+		conn.Write(frame(string(body)))
+	}
+}
+
+func apRep(req messages.APReq, subkey types.EncryptionKey) ([]byte, error) {
+	b, err := asn1.Marshal(messages.EncAPRepPart{
+		CTime:  req.Authenticator.CTime,
+		Cusec:  req.Authenticator.Cusec,
+		Subkey: subkey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	enc, err := crypto.GetEncryptedData(asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart),
+		req.Ticket.DecryptedEncPart.Key, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return nil, err
+	}
+	b, err = asn1.Marshal(messages.APRep{PVNO: 5, MsgType: msgtype.KRB_AP_REP, EncPart: enc})
+	if err != nil {
+		return nil, err
+	}
+
+	token, _ := asn1.Marshal(gssapi.OIDKRB5.OID())
+	token = append(token, 0x02, 0x00)
+	token = append(token, asn1tools.AddASNAppTag(b, asnAppTag.APREP)...)
+	return asn1tools.AddASNAppTag(token, 0), nil
+}
+
+func TestGSSAPI(t *testing.T) {
+	kt, cl := kerberos(t)
+
+	tests := []struct {
+		name     string
+		offer    QOP
+		accepted []QOP
+		qop      QOP
+		err      string
+	}{
+		{"confidentiality", QOPAuth | QOPIntegrity | QOPConfidentiality, nil, QOPConfidentiality, ""},
+		{"integrity", QOPAuth | QOPIntegrity, nil, QOPIntegrity, ""},
+		{"auth", QOPAuth | QOPIntegrity | QOPConfidentiality, []QOP{QOPAuth}, QOPAuth, ""},
+		{"preference", QOPIntegrity | QOPConfidentiality, []QOP{QOPIntegrity, QOPConfidentiality}, QOPIntegrity, ""},
+		{"no common qop", QOPConfidentiality, []QOP{QOPAuth}, 0, "server does not support any of accepted qop [auth]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			errs := make(chan error, 1)
+			go func() {
+				errs <- acceptor(server, kt, byte(tt.offer))
+				server.Close()
+			}()
+
+			trans, err := NewTSaslTransport(thrift.NewTSocketFromConnTimeout(client, time.Second), &Options{
+				Service:        "impala",
+				Host:           "localhost",
+				Mechanism:      MechGSSAPI,
+				QOP:            tt.accepted,
+				KerberosClient: cl,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer trans.Close()
+
+			err = trans.Open()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if trans.qop != tt.qop {
+				t.Errorf("qop = %s, want %s", trans.qop, tt.qop)
+			}
+
+			for _, msg := range []string{"hello", strings.Repeat("x", 5000)} {
+				trans.Write([]byte(msg))
+				if err := trans.Flush(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, len(msg))
+				if _, err := io.ReadFull(trans, buf); err != nil {
+					t.Fatal(err)
+				}
+				if expected := strings.ToUpper(msg); string(buf) != expected {
+					t.Errorf("got: %.20q, want: %.20q", buf, expected)
+				}
+			}
+
+			trans.Close()
+			if err := <-errs; err != nil {
+				t.Errorf("server: %v", err)
+			}
+		})
+	}
+}
+
+func TestSecurityContext(t *testing.T) {
+	etype, err := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := types.GenerateEncryptionKey(etype)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, seal := range []bool{false, true} {
+		initiator := &securityContext{key: key}
+		acceptor := &securityContext{key: key, acceptor: true}
+
+		token, err := initiator.wrap([]byte("payload"), seal)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// rotated token as sent by some implementations
+		rrc := 5
+		rotated := append([]byte{}, token[:16]...)
+		binary.BigEndian.PutUint16(rotated[6:8], uint16(rrc))
+		data := token[16:]
+		rotated = append(rotated, data[len(data)-rrc:]...)
+		rotated = append(rotated, data[:len(data)-rrc]...)
+
+		for _, tok := range [][]byte{token, rotated} {
+			payload, sealed, err := acceptor.unwrap(tok)
+			if err != nil {
+				t.Fatalf("seal %v: %v", seal, err)
+			}
+			if string(payload) != "payload" || sealed != seal {
+				t.Errorf("seal %v: got %q sealed %v", seal, payload, sealed)
+			}
+		}
+
+		// tokens are accepted only from peer
+		if _, _, err := initiator.unwrap(token); err == nil {
+			t.Errorf("seal %v: expected direction error", seal)
+		}
+
+		tampered := append([]byte{}, token...)
+		tampered[len(tampered)-20] ^= 1
+		if _, _, err := acceptor.unwrap(tampered); err == nil {
+			t.Errorf("seal %v: expected error for tampered token", seal)
+		}
+	}
+
+	if _, _, err := (&securityContext{key: key}).unwrap([]byte{1, 2, 3}); err == nil {
+		t.Error("expected malformed token error")
+	}
+}
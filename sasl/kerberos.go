@@ -0,0 +1,45 @@
+package sasl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+// LoadKerberosClient creates Kerberos client of credentials cache of kinit.
+// KRB5CCNAME or default cache of user is used if path is empty, and
+// KRB5_CONFIG or /etc/krb5.conf is loaded as configuration if it exists
+func LoadKerberosClient(path string) (*krb5.Client, error) {
+	if path == "" {
+		path = strings.TrimPrefix(os.Getenv("KRB5CCNAME"), "FILE:")
+	}
+	if path == "" {
+		path = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+	}
+	cc, err := credentials.LoadCCache(path)
+	if err != nil {
+		return nil, fmt.Errorf("sasl: failed to load kerberos credentials cache %s, run kinit or set KerberosClient: %w", path, err)
+	}
+
+	cfg := config.New()
+	cfgPath := os.Getenv("KRB5_CONFIG")
+	if cfgPath == "" {
+		cfgPath = "/etc/krb5.conf"
+	}
+	if _, err := os.Stat(cfgPath); err == nil {
+		cfg, err = config.Load(cfgPath)
+		if err != nil {
+			return nil, fmt.Errorf("sasl: failed to load kerberos config %s: %w", cfgPath, err)
+		}
+	}
+
+	cl, err := krb5.NewFromCCache(cc, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sasl: invalid kerberos credentials cache %s: %w", path, err)
+	}
+	return cl, nil
+}
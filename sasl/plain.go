@@ -16,3 +16,15 @@ func (m *plain) Start() (string, []byte, bool, error) {
 func (m *plain) Step(challenge []byte) ([]byte, bool, error) {
 	return nil, false, ErrUnexpectedServerChallenge
 }
+
+func (m *plain) QOP() QOP {
+	return QOPAuth
+}
+
+func (m *plain) Wrap(b []byte) ([]byte, error) {
+	return b, nil
+}
+
+func (m *plain) Unwrap(b []byte) ([]byte, error) {
+	return b, nil
+}
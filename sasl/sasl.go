@@ -1,6 +1,11 @@
 package sasl
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	krb5 "github.com/jcmturner/gokrb5/v8/client"
+)
 
 // Common SASL errors.
 var (
@@ -8,25 +13,96 @@ var (
 	ErrUnexpectedServerChallenge = errors.New("sasl: unexpected server challenge")
 )
 
+// AuthError is negotiation failure reported by server with BAD or ERROR status
+type AuthError struct {
+	Status  Status
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("sasl: negotiation failed. bad status: %d", e.Status)
+	}
+	return fmt.Sprintf("sasl: negotiation failed. bad status: %d: %s", e.Status, e.Message)
+}
+
 // Mech is SASL mechanism token
 type Mech string
 
 // SASL mechanism tokens
 const (
-	MechPlain = "PLAIN"
+	MechPlain     = "PLAIN"
+	MechGSSAPI    = "GSSAPI"
+	MechDigestMD5 = "DIGEST-MD5"
+)
+
+// QOP is SASL quality of protection. Values are bits of the security layer
+// mask exchanged during negotiation
+type QOP byte
+
+// Qualities of protection
+const (
+	// QOPAuth is authentication only
+	QOPAuth QOP = 1
+	// QOPIntegrity protects integrity of messages (auth-int)
+	QOPIntegrity QOP = 2
+	// QOPConfidentiality encrypts messages (auth-conf)
+	QOPConfidentiality QOP = 4
 )
 
+func (q QOP) String() string {
+	switch q {
+	case QOPAuth:
+		return "auth"
+	case QOPIntegrity:
+		return "auth-int"
+	case QOPConfidentiality:
+		return "auth-conf"
+	}
+	return fmt.Sprintf("QOP(%d)", byte(q))
+}
+
+// ParseQOP parses quality of protection as in sasl.qop property of hive
+func ParseQOP(s string) (QOP, error) {
+	for _, q := range []QOP{QOPAuth, QOPIntegrity, QOPConfidentiality} {
+		if q.String() == s {
+			return q, nil
+		}
+	}
+	return 0, fmt.Errorf("sasl: unknown qop %q", s)
+}
+
 // Options contains data related to SASL negotiation
 type Options struct {
 	Service  string
 	Host     string
 	Username string
 	Password string
+
+	// Mechanism to negotiate. MechPlain is used if empty
+	Mechanism string
+	// QOP lists accepted qualities of protection in order of preference.
+	// The strongest offered by server is selected if empty
+	QOP []QOP
+	// KerberosClient provides service tickets for GSSAPI mechanism
+	KerberosClient *krb5.Client
+
+	// MaxFrameSize limits size of frames and negotiation messages read from
+	// server. DefaultMaxFrameSize is used if zero
+	MaxFrameSize int
+	// BufferSize of underlying transport. DefaultBufferSize is used if zero
+	BufferSize int
 }
 
 // Client is SASL client
 type Client interface {
 	Start(mechlist []string) (mech string, initial []byte, done bool, err error)
 	Step(challenge []byte) (response []byte, done bool, err error)
+	// QOP returns quality of protection negotiated by mechanism
+	QOP() QOP
+	// Wrap protects outgoing message according to negotiated QOP
+	Wrap(b []byte) ([]byte, error)
+	// Unwrap verifies and decodes incoming message according to negotiated QOP
+	Unwrap(b []byte) ([]byte, error)
 	Free()
 }
@@ -0,0 +1,124 @@
+package sasl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DelegationToken is hadoop delegation token as issued by HiveServer2
+type DelegationToken struct {
+	Identifier []byte
+	Password   []byte
+	Kind       string
+	Service    string
+}
+
+// ParseDelegationToken decodes token from URL safe base64 string form of hadoop
+func ParseDelegationToken(s string) (*DelegationToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+	if err != nil {
+		return nil, fmt.Errorf("sasl: invalid delegation token: %w", err)
+	}
+
+	r := bytes.NewReader(b)
+	var fields [4][]byte
+	for i := range fields {
+		if fields[i], err = readBytes(r); err != nil {
+			return nil, fmt.Errorf("sasl: invalid delegation token: %w", err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("sasl: invalid delegation token: trailing data")
+	}
+
+	return &DelegationToken{
+		Identifier: fields[0],
+		Password:   fields[1],
+		Kind:       string(fields[2]),
+		Service:    string(fields[3]),
+	}, nil
+}
+
+// String encodes token in URL safe base64 string form of hadoop
+func (t *DelegationToken) String() string {
+	var b bytes.Buffer
+	for _, field := range [][]byte{t.Identifier, t.Password, []byte(t.Kind), []byte(t.Service)} {
+		writeVInt(&b, int64(len(field)))
+		b.Write(field)
+	}
+	return base64.RawURLEncoding.EncodeToString(b.Bytes())
+}
+
+// Credentials returns username and password of DIGEST-MD5 authentication
+// with token
+func (t *DelegationToken) Credentials() (username, password string) {
+	return base64.StdEncoding.EncodeToString(t.Identifier), base64.StdEncoding.EncodeToString(t.Password)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readVInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > int64(r.Len()) {
+		return nil, fmt.Errorf("invalid field length %d", n)
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
+
+// readVInt reads variable length integer of hadoop WritableUtils
+func readVInt(r *bytes.Reader) (int64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	b := int8(first)
+	if b >= -112 {
+		return int64(b), nil
+	}
+
+	negative := b < -120
+	size := -112 - int(b)
+	if negative {
+		size = -120 - int(b)
+	}
+	var v int64
+	for i := 0; i < size; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<8 | int64(c)
+	}
+	if negative {
+		v = ^v
+	}
+	return v, nil
+}
+
+// writeVInt writes variable length integer of hadoop WritableUtils
+func writeVInt(b *bytes.Buffer, v int64) {
+	if v >= -112 && v <= 127 {
+		b.WriteByte(byte(v))
+		return
+	}
+
+	prefix := -112
+	if v < 0 {
+		v = ^v
+		prefix = -120
+	}
+	size := 0
+	for tmp := v; tmp != 0; tmp >>= 8 {
+		size++
+	}
+	b.WriteByte(byte(int8(prefix - size)))
+	for i := size - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
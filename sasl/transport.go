@@ -6,17 +6,28 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"io/ioutil"
 
 	"github.com/apache/thrift/lib/go/thrift"
 )
 
-type TSaslTransport struct {
-	rbuf *bytes.Buffer
-	wbuf *bytes.Buffer
+// Defaults of transport options
+const (
+	DefaultMaxFrameSize = 100 * 1024 * 1024
+	DefaultBufferSize   = 4096
+)
 
-	trans thrift.TTransport
-	sasl  Client
+// TSaslTransport is thrift transport authenticated by SASL. After negotiation
+// each message is sent as a frame prefixed with 4 byte length
+type TSaslTransport struct {
+	rbuf bytes.Buffer
+	wbuf bytes.Buffer
+
+	trans        thrift.TTransport
+	sasl         Client
+	mechanism    string
+	maxFrameSize uint32
+	// qop negotiated by mechanism. Frames are wrapped unless it is QOPAuth
+	qop QOP
 }
 
 // Status is SASL negotiation status
@@ -31,15 +42,29 @@ const (
 	StatusComplete Status = 5
 )
 
+// NewTSaslTransport creates SASL transport over t. Reads and writes of t are buffered
 func NewTSaslTransport(t thrift.TTransport, opts *Options) (*TSaslTransport, error) {
 	sasl := NewClient(opts)
 
-	return &TSaslTransport{
-		trans: t,
-		sasl:  sasl,
+	maxFrameSize := opts.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	mechanism := opts.Mechanism
+	if mechanism == "" {
+		mechanism = MechPlain
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
 
-		rbuf: bytes.NewBuffer(nil),
-		wbuf: bytes.NewBuffer(nil),
+	return &TSaslTransport{
+		trans:        thrift.NewTBufferedTransport(t, bufferSize),
+		sasl:         sasl,
+		mechanism:    mechanism,
+		maxFrameSize: uint32(maxFrameSize),
+		qop:          QOPAuth,
 	}, nil
 }
 
@@ -55,93 +80,138 @@ func (t *TSaslTransport) Open() error {
 		}
 	}
 
-	mech, initial, _, err := t.sasl.Start([]string{MechPlain})
+	mech, initial, done, err := t.sasl.Start([]string{t.mechanism})
 	if err != nil {
 		return err
 	}
 
 	if err := t.negotiationSend(StatusStart, []byte(mech)); err != nil {
-		return fmt.Errorf("sasl: negotiation failed. %v", err)
+		return fmt.Errorf("sasl: negotiation failed. %w", err)
 	}
 	if err := t.negotiationSend(StatusOK, initial); err != nil {
-		return fmt.Errorf("sasl: negotiation failed. %v", err)
+		return fmt.Errorf("sasl: negotiation failed. %w", err)
 	}
 
 	for {
-		status, challenge, err := t.recieve()
+		status, challenge, err := t.receive()
 		if err != nil {
-			return fmt.Errorf("sasl: negotiation failed. %v", err)
+			return fmt.Errorf("sasl: negotiation failed. %w", err)
 		}
 
+		if status == StatusBad || status == StatusError {
+			return &AuthError{Status: status, Message: string(challenge)}
+		}
 		if status != StatusOK && status != StatusComplete {
-			return fmt.Errorf("sasl: negotiation failed. bad status: %d", status)
+			return fmt.Errorf("sasl: negotiation failed. unexpected status: %d", status)
 		}
 
+		// server may complete negotiation with the last challenge, as java
+		// server does with rspauth of DIGEST-MD5
 		if status == StatusComplete {
+			if !done && len(challenge) > 0 {
+				if _, _, err := t.sasl.Step(challenge); err != nil {
+					return fmt.Errorf("sasl: negotiation failed. %w", err)
+				}
+			}
 			break
 		}
 
-		payload, _, err := t.sasl.Step(challenge)
+		var payload []byte
+		payload, done, err = t.sasl.Step(challenge)
 		if err != nil {
-			return fmt.Errorf("sasl: negotiation failed. %v", err)
+			return fmt.Errorf("sasl: negotiation failed. %w", err)
 		}
 		if err := t.negotiationSend(StatusOK, payload); err != nil {
-			return fmt.Errorf("sasl: negotiation failed. %v", err)
+			return fmt.Errorf("sasl: negotiation failed. %w", err)
 		}
 
 	}
+
+	t.qop = t.sasl.QOP()
 	return nil
 
 }
 
 func (t *TSaslTransport) Read(buf []byte) (int, error) {
-	n, err := t.rbuf.Read(buf)
-	if err != nil && err != io.EOF {
-		return 0, err
-	}
-	if err == io.EOF {
-		return t.readFrame(buf)
+	if t.rbuf.Len() == 0 {
+		if err := t.readFrame(); err != nil {
+			return 0, err
+		}
 	}
-	return n, nil
+	return t.rbuf.Read(buf)
 }
 
-func (t *TSaslTransport) readFrame(buf []byte) (int, error) {
-	header := make([]byte, 4)
-	_, err := t.trans.Read(header)
+// readFrame reads next frame into read buffer
+func (t *TSaslTransport) readFrame() error {
+	l, err := t.readLength()
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	l := binary.BigEndian.Uint32(header)
+	t.rbuf.Reset()
+	if _, err := io.CopyN(&t.rbuf, t.trans, int64(l)); err != nil {
+		return unexpectedEOF(err)
+	}
 
-	body := make([]byte, l)
-	_, err = io.ReadFull(t.trans, body)
-	if err != nil {
+	if t.qop != QOPAuth {
+		payload, err := t.sasl.Unwrap(t.rbuf.Bytes())
+		if err != nil {
+			return err
+		}
+		t.rbuf.Reset()
+		t.rbuf.Write(payload)
+	}
+	return nil
+}
+
+// readLength reads 4 byte length and checks it against maximum frame size
+func (t *TSaslTransport) readLength() (uint32, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(t.trans, header[:]); err != nil {
 		return 0, err
 	}
-	t.rbuf = bytes.NewBuffer(body)
-	return t.rbuf.Read(buf)
+
+	l := binary.BigEndian.Uint32(header[:])
+	if l > t.maxFrameSize {
+		return 0, fmt.Errorf("sasl: frame size %d exceeds maximum %d", l, t.maxFrameSize)
+	}
+	return l, nil
+}
+
+func (t *TSaslTransport) writeLength(l int) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(l))
+	_, err := t.trans.Write(header[:])
+	return err
 }
 
 func (t *TSaslTransport) Write(buf []byte) (int, error) {
 	return t.wbuf.Write(buf)
 }
 
+// Flush writes buffered data as one frame, wrapped according to negotiated QOP
 func (t *TSaslTransport) Flush(ctx context.Context) error {
+	if t.qop != QOPAuth {
+		payload, err := t.sasl.Wrap(t.wbuf.Bytes())
+		t.wbuf.Reset()
+		if err != nil {
+			return err
+		}
+		if err := t.writeLength(len(payload)); err != nil {
+			return err
+		}
+		if _, err := t.trans.Write(payload); err != nil {
+			return err
+		}
+		return t.trans.Flush(ctx)
+	}
 
-	in, err := ioutil.ReadAll(t.wbuf)
-	if err != nil {
+	if err := t.writeLength(t.wbuf.Len()); err != nil {
+		return err
+	}
+	if _, err := t.wbuf.WriteTo(t.trans); err != nil {
 		return err
 	}
-
-	v := len(in)
-	var payload []byte
-	payload = append(payload, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
-	payload = append(payload, in...)
-
-	t.trans.Write(payload)
-
-	t.wbuf.Reset()
 	return t.trans.Flush(ctx)
 }
 
@@ -155,28 +225,41 @@ func (t *TSaslTransport) Close() error {
 }
 
 func (t *TSaslTransport) negotiationSend(status Status, body []byte) error {
-	var payload []byte
-	payload = append(payload, byte(status))
-	v := len(body)
-	payload = append(payload, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
-	payload = append(payload, body...)
-	_, err := t.trans.Write(payload)
-	if err != nil {
+	if _, err := t.trans.Write([]byte{byte(status)}); err != nil {
 		return err
 	}
-
-	if err := t.trans.Flush(context.Background()); err != nil {
+	if err := t.writeLength(len(body)); err != nil {
 		return err
 	}
-
-	return nil
+	if _, err := t.trans.Write(body); err != nil {
+		return err
+	}
+	return t.trans.Flush(context.Background())
 }
 
-func (t *TSaslTransport) recieve() (Status, []byte, error) {
-	header := make([]byte, 5)
-	_, err := t.trans.Read(header)
+// receive reads negotiation status and payload
+func (t *TSaslTransport) receive() (Status, []byte, error) {
+	var status [1]byte
+	if _, err := io.ReadFull(t.trans, status[:]); err != nil {
+		return 0, nil, err
+	}
+
+	l, err := t.readLength()
 	if err != nil {
 		return 0, nil, err
 	}
-	return Status(header[0]), header[1:], nil
+
+	payload := make([]byte, l)
+	if _, err := io.ReadFull(t.trans, payload); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	return Status(status[0]), payload, nil
+}
+
+// unexpectedEOF reports end of stream in the middle of a message
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
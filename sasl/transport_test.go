@@ -0,0 +1,150 @@
+package sasl
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+func message(status Status, body string) []byte {
+	msg := []byte{byte(status), 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(body)))
+	return append(msg, body...)
+}
+
+func frame(body string) []byte {
+	msg := make([]byte, 4)
+	binary.BigEndian.PutUint32(msg, uint32(len(body)))
+	return append(msg, body...)
+}
+
+// serve reads negotiation of PLAIN client and replies with response
+func serve(conn net.Conn, response []byte) {
+	for i := 0; i < 2; i++ {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		if _, err := io.CopyN(ioutil.Discard, conn, int64(binary.BigEndian.Uint32(header[1:]))); err != nil {
+			return
+		}
+	}
+	conn.Write(response)
+}
+
+func open(t *testing.T, response []byte) (*TSaslTransport, error) {
+	client, server := net.Pipe()
+	go func() {
+		serve(server, response)
+		server.Close()
+	}()
+
+	trans, err := NewTSaslTransport(thrift.NewTSocketFromConnTimeout(client, time.Second), &Options{
+		Username:     "admin",
+		Password:     "secret",
+		MaxFrameSize: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trans.Close() })
+	return trans, trans.Open()
+}
+
+func TestNegotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+		err      string
+	}{
+		{"complete", message(StatusComplete, ""), ""},
+		{"complete with payload", message(StatusComplete, "welcome"), ""},
+		{"bad status", message(StatusBad, "denied"), "bad status: 3: denied"},
+		{"error status", message(StatusError, ""), "bad status: 4"},
+		{"unexpected status", message(Status(0x80), ""), "unexpected status: 128"},
+		{"challenge", message(StatusOK, "challenge"), ErrUnexpectedServerChallenge.Error()},
+		{"oversized", message(StatusComplete, strings.Repeat("x", 17)), "frame size 17 exceeds maximum 16"},
+		{"truncated", message(StatusComplete, "welcome")[:8], "EOF"},
+		{"closed", nil, "EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := open(t, tt.response)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestReadFrames(t *testing.T) {
+	var response []byte
+	response = append(response, message(StatusComplete, "")...)
+	response = append(response, frame("hello ")...)
+	response = append(response, frame("world")...)
+	response = append(response, frame(strings.Repeat("x", 17))...)
+
+	trans, err := open(t, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 11)
+	if _, err := io.ReadFull(trans, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello world" {
+		t.Errorf("got: %q, want: %q", buf, "hello world")
+	}
+
+	_, err = trans.Read(buf)
+	if err == nil || !strings.Contains(err.Error(), "frame size 17 exceeds maximum 16") {
+		t.Errorf("expected frame size error, got %v", err)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	received := make(chan []byte)
+	go func() {
+		serve(server, message(StatusComplete, ""))
+		buf := make([]byte, 4+len("hello world"))
+		io.ReadFull(server, buf)
+		received <- buf
+	}()
+
+	trans, err := NewTSaslTransport(thrift.NewTSocketFromConnTimeout(client, time.Second), &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trans.Close()
+	if err := trans.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	trans.Write([]byte("hello "))
+	trans.Write([]byte("world"))
+	if err := trans.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := <-received; string(actual) != string(frame("hello world")) {
+		t.Errorf("got: %q, want: %q", actual, frame("hello world"))
+	}
+}
@@ -0,0 +1,952 @@
+package impala
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bippio/go-impala/hive"
+	"github.com/bippio/go-impala/impalatest"
+	"github.com/bippio/go-impala/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newServer(t *testing.T, opts impalatest.Options) *impalatest.Server {
+	srv, err := impalatest.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func openServer(t *testing.T, srv *impalatest.Server, configure func(*Options)) *sql.DB {
+	opts := DefaultOptions
+	opts.Host = srv.Host()
+	opts.Port = srv.Port()
+	if configure != nil {
+		configure(&opts)
+	}
+	db := sql.OpenDB(NewConnector(&opts))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestServerQuery(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	ts := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	srv.Handle("SELECT * FROM t", &impalatest.Result{
+		Columns: []impalatest.Column{
+			{Name: "b", Type: "BOOLEAN"},
+			{Name: "i", Type: "INT"},
+			{Name: "l", Type: "BIGINT"},
+			{Name: "d", Type: "DOUBLE"},
+			{Name: "s", Type: "STRING"},
+			{Name: "ts", Type: "TIMESTAMP"},
+		},
+		Rows: [][]interface{}{
+			{true, 1, int64(10), 1.5, "a", ts},
+			{false, 2, int64(20), 2.5, nil, ts},
+			{nil, nil, nil, nil, "c", nil},
+		},
+	})
+
+	db := openServer(t, srv, func(opts *Options) { opts.BatchSize = 2 })
+
+	rows, err := db.Query("SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var actual [][]interface{}
+	for rows.Next() {
+		var (
+			b  sql.NullBool
+			i  sql.NullInt32
+			l  sql.NullInt64
+			d  sql.NullFloat64
+			s  sql.NullString
+			tm sql.NullTime
+		)
+		if err := rows.Scan(&b, &i, &l, &d, &s, &tm); err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, []interface{}{b, i, l, d, s, tm})
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]interface{}{
+		{sql.NullBool{Bool: true, Valid: true}, sql.NullInt32{Int32: 1, Valid: true}, sql.NullInt64{Int64: 10, Valid: true},
+			sql.NullFloat64{Float64: 1.5, Valid: true}, sql.NullString{String: "a", Valid: true}, sql.NullTime{Time: ts, Valid: true}},
+		{sql.NullBool{Bool: false, Valid: true}, sql.NullInt32{Int32: 2, Valid: true}, sql.NullInt64{Int64: 20, Valid: true},
+			sql.NullFloat64{Float64: 2.5, Valid: true}, sql.NullString{}, sql.NullTime{Time: ts, Valid: true}},
+		{sql.NullBool{}, sql.NullInt32{}, sql.NullInt64{}, sql.NullFloat64{}, sql.NullString{String: "c", Valid: true}, sql.NullTime{}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got: %v, want: %v", actual, expected)
+	}
+}
+
+func TestServerExec(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("CREATE TABLE t (i int)", &impalatest.Result{})
+
+	db := openServer(t, srv, nil)
+	if _, err := db.Exec("CREATE TABLE t (i int)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("DROP TABLE t"); err == nil || !strings.Contains(err.Error(), "unexpected statement") {
+		t.Errorf("expected unexpected statement error, got %v", err)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT * FROM missing", &impalatest.Result{
+		Err: errors.New("AnalysisException: Could not resolve table reference: 'missing'"),
+	})
+
+	db := openServer(t, srv, nil)
+	_, err := db.Query("SELECT * FROM missing")
+	if err == nil || !strings.Contains(err.Error(), "AnalysisException") {
+		t.Errorf("expected analysis exception, got %v", err)
+	}
+}
+
+func TestServerInterpolation(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.HandleFunc(func(stmt string) *impalatest.Result {
+		return &impalatest.Result{}
+	})
+
+	db := openServer(t, srv, nil)
+	if _, err := db.Exec("INSERT INTO t VALUES (?, '?')", 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"INSERT INTO t VALUES (1, 'a')"}
+	if actual := srv.Statements(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got: %q, want: %q", actual, expected)
+	}
+}
+
+func TestServerSASLAndTLS(t *testing.T) {
+	srv := newServer(t, impalatest.Options{Username: "admin", Password: "secret", TLS: true})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	db := openServer(t, srv, func(opts *Options) {
+		opts.UseLDAP = true
+		opts.Username = "admin"
+		opts.Password = "secret"
+		opts.UseTLS = true
+		opts.TLSConfig = &tls.Config{RootCAs: pool}
+	})
+
+	var v int8
+	if err := db.QueryRow("SELECT 1").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 1 {
+		t.Errorf("got: %d, want: 1", v)
+	}
+
+	dsn, err := sql.Open("impala", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dsn.Close()
+	if err := dsn.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := openServer(t, srv, func(opts *Options) {
+		opts.UseLDAP = true
+		opts.Username = "admin"
+		opts.Password = "wrong"
+		opts.UseTLS = true
+		opts.TLSConfig = &tls.Config{RootCAs: pool}
+	})
+	if err := bad.Ping(); err == nil {
+		t.Error("expected authentication failure")
+	}
+}
+
+func TestServerSlowQuery(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT sleep(100)", &impalatest.Result{Delay: 100 * time.Millisecond})
+
+	db := openServer(t, srv, nil)
+	start := time.Now()
+	if _, err := db.Exec("SELECT sleep(100)"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("statement finished in %v, expected delay", d)
+	}
+}
+
+func TestServerRetryAdmission(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	attempts := 0
+	srv.HandleFunc(func(stmt string) *impalatest.Result {
+		attempts++
+		if attempts == 1 {
+			return &impalatest.Result{Err: errors.New("Rejected query from pool root.default: queue full")}
+		}
+		return &impalatest.Result{
+			Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+			Rows:    [][]interface{}{{1}},
+		}
+	})
+
+	db := openServer(t, srv, func(opts *Options) {
+		opts.Retry = &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	})
+
+	var v int8
+	if err := db.QueryRowContext(context.Background(), "SELECT 1").Scan(&v); err != nil {
+		t.Fatalf("expected retry after admission rejection, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestServerAuthModes(t *testing.T) {
+	raw := newServer(t, impalatest.Options{})
+	none := newServer(t, impalatest.Options{SASL: true})
+	ldap := newServer(t, impalatest.Options{Username: "admin", Password: "secret"})
+	for _, srv := range []*impalatest.Server{raw, none, ldap} {
+		srv.Handle("SELECT 1", &impalatest.Result{
+			Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+			Rows:    [][]interface{}{{1}},
+		})
+	}
+
+	tests := []struct {
+		name string
+		srv  *impalatest.Server
+		opts Options
+		err  string
+	}{
+		{"noauth", raw, Options{Auth: AuthNoAuth}, ""},
+		{"nosasl", raw, Options{Auth: AuthNoSASL}, ""},
+		{"plain anonymous", none, Options{Auth: AuthPlain}, ""},
+		{"plain", none, Options{Auth: AuthPlain, Username: "alice"}, ""},
+		{"ldap", ldap, Options{Auth: AuthLDAP, Username: "admin", Password: "secret"}, ""},
+		{"use ldap", ldap, Options{UseLDAP: true, Username: "admin", Password: "secret"}, ""},
+		{"wrong password", ldap, Options{Auth: AuthLDAP, Username: "admin", Password: "wrong"}, "authentication failed (auth=ldap)"},
+		{"sasl to raw server", raw, Options{Auth: AuthPlain}, "server may not expect SASL authentication (auth=plain)"},
+		{"raw to sasl server", none, Options{Auth: AuthNoAuth}, "server may expect SASL authentication (auth=noauth)"},
+		{"missing ccache", raw, Options{Auth: AuthKerberos, KerberosCCache: "/nonexistent"}, "failed to load kerberos credentials cache /nonexistent"},
+		{"missing delegation token", none, Options{Auth: AuthDelegationToken}, "Please provide delegation token"},
+		{"credential provider", ldap, Options{Auth: AuthLDAP, Username: "admin", CredentialProvider: NewCommandCredentialProvider("echo", "secret")}, ""},
+		{"credential provider username", ldap, Options{Auth: AuthLDAP, CredentialProvider: NewCommandCredentialProvider("sh", "-c", "echo secret")}, "Please provide username for LDAP auth"},
+		{"credential provider failure", ldap, Options{Auth: AuthLDAP, Username: "admin", CredentialProvider: NewEnvCredentialProvider("IMPALA_TEST_MISSING")}, "IMPALA_TEST_MISSING is not set"},
+		{"unknown auth", raw, Options{Auth: "Kerberos"}, "auth Kerberos not recognized"},
+		{"credential provider without password auth", raw, Options{Auth: AuthNoAuth, CredentialProvider: NewEnvCredentialProvider("IMPALA_TEST_MISSING")}, "credential provider requires auth plain or ldap, not noauth"},
+		{"credential provider with kerberos", raw, Options{Auth: AuthKerberos, CredentialProvider: NewEnvCredentialProvider("IMPALA_TEST_MISSING")}, "credential provider requires auth plain or ldap, not kerberos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openServer(t, tt.srv, func(opts *Options) {
+				opts.Auth = tt.opts.Auth
+				opts.UseLDAP = tt.opts.UseLDAP
+				opts.Username = tt.opts.Username
+				opts.Password = tt.opts.Password
+				opts.KerberosCCache = tt.opts.KerberosCCache
+				opts.CredentialProvider = tt.opts.CredentialProvider
+			})
+
+			var v int8
+			err := db.QueryRow("SELECT 1").Scan(&v)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestServerDelegationToken(t *testing.T) {
+	srv := newServer(t, impalatest.Options{SASL: true})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+	ctx := context.Background()
+
+	parent := openServer(t, srv, func(opts *Options) {
+		opts.Auth = AuthPlain
+		opts.Username = "alice"
+	})
+	conn, err := parent.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// withSession calls token RPCs on the raw driver connection
+	withSession := func(fn func(s *hive.Session) error) error {
+		return conn.Raw(func(driverConn interface{}) error {
+			s, err := driverConn.(*Conn).OpenSession(ctx)
+			if err != nil {
+				return err
+			}
+			return fn(s)
+		})
+	}
+
+	var token string
+	if err := withSession(func(s *hive.Session) (err error) {
+		token, err = s.GetDelegationToken(ctx, "alice", "alice")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := withSession(func(s *hive.Session) error {
+		return s.RenewDelegationToken(ctx, token)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	worker := func() error {
+		db := openServer(t, srv, func(opts *Options) {
+			opts.Auth = AuthDelegationToken
+			opts.DelegationToken = token
+		})
+		var v int8
+		return db.QueryRow("SELECT 1").Scan(&v)
+	}
+	if err := worker(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := withSession(func(s *hive.Session) error {
+		return s.CancelDelegationToken(ctx, token)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := worker(); err == nil || !strings.Contains(err.Error(), "authentication failed (auth=delegation-token)") {
+		t.Errorf("expected authentication failure with canceled token, got %v", err)
+	}
+	if err := withSession(func(s *hive.Session) error {
+		return s.RenewDelegationToken(ctx, token)
+	}); err == nil {
+		t.Error("expected error renewing canceled token")
+	}
+}
+
+// tokenFunc is TokenProvider which returns result of function
+type tokenFunc func() string
+
+func (f tokenFunc) Token(ctx context.Context) (string, error) {
+	return f(), nil
+}
+
+func TestServerHTTP(t *testing.T) {
+	raw := newServer(t, impalatest.Options{HTTP: true})
+	ldap := newServer(t, impalatest.Options{HTTP: true, Username: "admin", Password: "secret"})
+	jwt := newServer(t, impalatest.Options{HTTP: true, BearerToken: "token-1"})
+	for _, srv := range []*impalatest.Server{raw, ldap, jwt} {
+		srv.Handle("SELECT 1", &impalatest.Result{
+			Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+			Rows:    [][]interface{}{{1}},
+		})
+	}
+
+	tests := []struct {
+		name string
+		srv  *impalatest.Server
+		opts Options
+		err  string
+	}{
+		{"noauth", raw, Options{Auth: AuthNoAuth}, ""},
+		{"ldap", ldap, Options{Auth: AuthLDAP, Username: "admin", Password: "secret"}, ""},
+		{"wrong password", ldap, Options{Auth: AuthLDAP, Username: "admin", Password: "wrong"}, "authentication failed (auth=ldap)"},
+		{"jwt", jwt, Options{Auth: AuthJWT, TokenProvider: StaticToken("token-1")}, ""},
+		{"wrong token", jwt, Options{Auth: AuthJWT, TokenProvider: StaticToken("token-0")}, "authentication failed (auth=jwt)"},
+		{"missing provider", jwt, Options{Auth: AuthJWT}, "Please provide token provider"},
+		{"kerberos", raw, Options{Auth: AuthKerberos}, "auth kerberos is not supported with protocol hs2-http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openServer(t, tt.srv, func(opts *Options) {
+				opts.Protocol = ProtocolHiveServer2HTTP
+				opts.Auth = tt.opts.Auth
+				opts.Username = tt.opts.Username
+				opts.Password = tt.opts.Password
+				opts.TokenProvider = tt.opts.TokenProvider
+			})
+
+			var v int8
+			err := db.QueryRow("SELECT 1").Scan(&v)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	t.Run("jwt over binary protocol", func(t *testing.T) {
+		db := openServer(t, raw, func(opts *Options) {
+			opts.Auth = AuthJWT
+			opts.TokenProvider = StaticToken("token-1")
+		})
+		if err := db.Ping(); err == nil || !strings.Contains(err.Error(), "requires protocol hs2-http") {
+			t.Errorf("expected protocol error, got %v", err)
+		}
+	})
+}
+
+func TestServerHTTPTokenRefresh(t *testing.T) {
+	srv := newServer(t, impalatest.Options{HTTP: true, BearerToken: "token-1"})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+
+	var mu sync.Mutex
+	current, calls := "token-1", 0
+	db := openServer(t, srv, func(opts *Options) {
+		opts.Protocol = ProtocolHiveServer2HTTP
+		opts.Auth = AuthJWT
+		opts.TokenProvider = tokenFunc(func() string {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return current
+		})
+	})
+	db.SetMaxOpenConns(1)
+
+	var v int8
+	if err := db.QueryRow("SELECT 1").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	// token expires on the open connection and provider has the next one
+	srv.SetBearerToken("token-2")
+	mu.Lock()
+	current = "token-2"
+	mu.Unlock()
+	if err := db.QueryRow("SELECT 1").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("provider called %d times, want 2", calls)
+	}
+}
+
+func TestServerImpersonation(t *testing.T) {
+	srv := newServer(t, impalatest.Options{SASL: true})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+	ctx := context.Background()
+
+	db := openServer(t, srv, func(opts *Options) {
+		opts.Auth = AuthPlain
+		opts.Username = "service"
+		opts.ImpersonateUser = "bob"
+	})
+	db.SetMaxOpenConns(1)
+
+	users := func() []string {
+		var users []string
+		for _, s := range srv.Sessions() {
+			users = append(users, s.Configuration[hive.ConfImpersonateUser])
+		}
+		return users
+	}
+	query := func(ctx context.Context) {
+		t.Helper()
+		var v int8
+		if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ctx := range []context.Context{ctx, WithImpersonation(ctx, "carol"), ctx} {
+		var v int8
+		if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := users(), []string{"bob", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sessions of users %v, want %v", got, want)
+	}
+	conn.Close()
+
+	// sessions of previous users are closed when connection is reused
+	query(WithImpersonation(ctx, "dave"))
+	if got, want := users(), []string{"dave"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sessions of users %v, want %v", got, want)
+	}
+
+	// empty user disables impersonation of options
+	query(WithImpersonation(ctx, ""))
+	if got, want := users(), []string{""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sessions of users %v, want %v", got, want)
+	}
+
+	beeswax := openServer(t, newServer(t, impalatest.Options{}), func(opts *Options) {
+		opts.Protocol = ProtocolBeeswax
+		opts.ImpersonateUser = "bob"
+	})
+	if err := beeswax.Ping(); !errors.Is(err, errImpersonationNotSupported) {
+		t.Errorf("expected impersonation error with beeswax, got %v", err)
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	// server accepts connection but never answers SASL negotiation
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	opts := DefaultOptions
+	opts.Host, opts.Port = host, port
+	opts.Auth = AuthPlain
+	opts.Username, opts.Password = "admin", "secret"
+	opts.ConnectTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := NewConnector(&opts).Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Errorf("expected interrupted negotiation, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("connect returned after %v", d)
+	}
+
+	// read of established connection times out
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "i", Type: "INT"}},
+		Rows:    [][]interface{}{{1}},
+		Delay:   time.Second,
+	})
+	opts = DefaultOptions
+	opts.Host, opts.Port = srv.Host(), srv.Port()
+	opts.SocketTimeout = 50 * time.Millisecond
+
+	conn, err := NewConnector(&opts).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT 1", nil); err != driver.ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	if conn.(driver.Validator).IsValid() {
+		t.Error("connection is valid after timeout")
+	}
+}
+
+func TestServerDatabase(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "1", Type: "TINYINT"}},
+		Rows:    [][]interface{}{{1}},
+	})
+	ctx := context.Background()
+
+	db := openServer(t, srv, func(opts *Options) {
+		opts.Database = "sales"
+	})
+	db.SetMaxOpenConns(1)
+
+	// session is created again after reset of pooled connection
+	for _, ctx := range []context.Context{ctx, ctx, WithImpersonation(ctx, "bob")} {
+		var v int8
+		if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		sessions := srv.Sessions()
+		if len(sessions) != 1 {
+			t.Fatalf("%d sessions, want 1", len(sessions))
+		}
+		if db := sessions[0].Configuration[hive.ConfUseDatabase]; db != "sales" {
+			t.Errorf("database of session = %q, want sales", db)
+		}
+	}
+	if user := srv.Sessions()[0].Configuration[hive.ConfImpersonateUser]; user != "bob" {
+		t.Errorf("impersonated user = %q, want bob", user)
+	}
+
+	dsn, err := sql.Open("impala", "impala://"+net.JoinHostPort(srv.Host(), srv.Port())+"/analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dsn.Close()
+	if err := dsn.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if sessions := srv.Sessions(); sessions[len(sessions)-1].Configuration[hive.ConfUseDatabase] != "analytics" {
+		t.Errorf("database of DSN is not used: %v", sessions)
+	}
+}
+
+func TestServerInfoLazy(t *testing.T) {
+	tests := []struct {
+		version  string
+		scanType reflect.Type
+	}{
+		{version: "impalad version 3.2.0-cdh6.3.2 RELEASE", scanType: reflect.TypeOf("")},
+		{version: "impalad version 3.4.0 RELEASE", scanType: reflect.TypeOf(time.Time{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			srv := newServer(t, impalatest.Options{Version: tt.version})
+			srv.Handle("SELECT d", &impalatest.Result{
+				Columns: []impalatest.Column{{Name: "d", Type: "DATE"}},
+				Rows:    [][]interface{}{{time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			})
+
+			opts := DefaultOptions
+			opts.Host, opts.Port = srv.Host(), srv.Port()
+			ctx := context.Background()
+			client, transport, err := DialHive(ctx, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer transport.Close()
+
+			session, err := client.OpenSession(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := client.ServerInfo(); info != nil {
+				t.Errorf("server info %+v fetched with session", info)
+			}
+
+			op, err := session.ExecuteStatement(ctx, "SELECT d")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer op.Close(ctx)
+			schema, err := op.GetResultSetMetadata(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st := schema.Columns[0].ScanType; st != tt.scanType {
+				t.Errorf("scan type %v, want %v", st, tt.scanType)
+			}
+
+			info := client.ServerInfo()
+			if info == nil || info.DBMSVersion != tt.version {
+				t.Fatalf("server info %+v not fetched for DATE column", info)
+			}
+			if cached, err := session.Info(ctx); err != nil || cached != info {
+				t.Errorf("server info %+v, %v not cached", cached, err)
+			}
+		})
+	}
+}
+
+func TestServerDateType(t *testing.T) {
+	tests := []struct {
+		version string
+		value   interface{}
+		str     string
+	}{
+		{version: "impalad version 3.2.0-cdh6.3.2 RELEASE", value: "2019-01-01", str: "2019-01-01"},
+		{version: "impalad version 3.3.0 RELEASE", value: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), str: "2019-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			srv := newServer(t, impalatest.Options{Version: tt.version})
+			srv.Handle("SELECT d", &impalatest.Result{
+				Columns: []impalatest.Column{{Name: "d", Type: "DATE"}},
+				Rows:    [][]interface{}{{time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			})
+			db := openServer(t, srv, nil)
+
+			var v interface{}
+			if err := db.QueryRow("SELECT d").Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.value {
+				t.Errorf("got %#v, want %#v", v, tt.value)
+			}
+
+			var str string
+			if err := db.QueryRow("SELECT d").Scan(&str); err != nil {
+				t.Fatal(err)
+			}
+			if str != tt.str {
+				t.Errorf("got %q, want %q", str, tt.str)
+			}
+		})
+	}
+}
+
+func TestServerTracing(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT * FROM t WHERE id > 1", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "id", Type: "INT"}},
+		Rows:    [][]interface{}{{2}, {3}, {4}},
+	})
+	srv.Handle("SELECT broken", &impalatest.Result{Err: errors.New("AnalysisException: table not found")})
+
+	recorder := tracetest.NewSpanRecorder()
+	db := openServer(t, srv, func(opts *Options) {
+		opts.BatchSize = 2
+		opts.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	})
+
+	rows, err := db.Query("SELECT * FROM t WHERE id > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT broken"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = append(spans[s.Name()], s)
+	}
+	attrs := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	// connection opens session for each statement, see ResetSession
+	open := spans["hive.OpenSession"]
+	if len(open) != 2 {
+		t.Fatalf("%d OpenSession spans, want 2", len(open))
+	}
+	session := attrs(open[0])[hive.AttrSession].AsString()
+	if session == "" || attrs(open[0])[hive.AttrDBSystem].AsString() != "impala" {
+		t.Errorf("OpenSession attributes %v", open[0].Attributes())
+	}
+	if open[0].SpanKind() != trace.SpanKindClient || open[0].Status().Code != codes.Unset {
+		t.Errorf("OpenSession kind %v, status %v", open[0].SpanKind(), open[0].Status())
+	}
+
+	exec := spans["hive.ExecuteStatement"]
+	if len(exec) != 2 {
+		t.Fatalf("%d ExecuteStatement spans, want 2", len(exec))
+	}
+	a := attrs(exec[0])
+	if a[hive.AttrDBStatement].AsString() != "SELECT * FROM t WHERE id > ?" || a[hive.AttrSession].AsString() != session ||
+		a[hive.AttrOperation].AsString() == "" || !a[hive.AttrHasResultSet].AsBool() {
+		t.Errorf("ExecuteStatement attributes %v", exec[0].Attributes())
+	}
+	if exec[0].Status().Code != codes.Unset {
+		t.Errorf("ExecuteStatement status %v", exec[0].Status())
+	}
+	if st := exec[1].Status(); st.Code != codes.Error || !strings.Contains(st.Description, "table not found") {
+		t.Errorf("failed ExecuteStatement status %v", st)
+	}
+	if events := exec[1].Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("failed ExecuteStatement events %v, want recorded error", events)
+	}
+
+	fetch := spans["hive.FetchResults"]
+	if len(fetch) < 2 {
+		t.Fatalf("%d FetchResults spans, want batches of 2 rows", len(fetch))
+	}
+	var total int64
+	for i, s := range fetch {
+		a := attrs(s)
+		if a[hive.AttrOperation] != attrs(exec[0])[hive.AttrOperation] || a[hive.AttrBatch].AsInt64() != int64(i+1) {
+			t.Errorf("FetchResults attributes %v", s.Attributes())
+		}
+		if s.Parent().SpanID() != exec[0].Parent().SpanID() {
+			t.Errorf("FetchResults parent %v, want parent of statement", s.Parent())
+		}
+		total += a[hive.AttrRows].AsInt64()
+	}
+	if total != 3 {
+		t.Errorf("fetched %d rows, want 3", total)
+	}
+
+	closed := spans["hive.CloseOperation"]
+	if len(closed) != 1 || attrs(closed[0])[hive.AttrTotalRows].AsInt64() != 3 {
+		t.Errorf("CloseOperation spans %v", closed)
+	}
+}
+
+// recordingHook records metrics of driver
+type recordingHook struct {
+	mu        sync.Mutex
+	opened    int
+	closed    int
+	outcomes  map[metrics.Outcome]int
+	fetches   int
+	rows      int
+	bytes     int
+	latencies map[metrics.Phase][]time.Duration
+}
+
+func (h *recordingHook) SessionOpened() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.opened++
+}
+
+func (h *recordingHook) SessionClosed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed++
+}
+
+func (h *recordingHook) StatementFinished(outcome metrics.Outcome) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.outcomes == nil {
+		h.outcomes = map[metrics.Outcome]int{}
+	}
+	h.outcomes[outcome]++
+}
+
+func (h *recordingHook) FetchRoundTrip() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fetches++
+}
+
+func (h *recordingHook) RowsReceived(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rows += n
+}
+
+func (h *recordingHook) BytesReceived(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bytes += n
+}
+
+func (h *recordingHook) ObserveLatency(phase metrics.Phase, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.latencies == nil {
+		h.latencies = map[metrics.Phase][]time.Duration{}
+	}
+	h.latencies[phase] = append(h.latencies[phase], d)
+}
+
+func TestServerMetrics(t *testing.T) {
+	srv := newServer(t, impalatest.Options{})
+	srv.Handle("SELECT * FROM t", &impalatest.Result{
+		Columns: []impalatest.Column{{Name: "id", Type: "INT"}},
+		Rows:    [][]interface{}{{1}, {2}, {3}},
+		Delay:   10 * time.Millisecond,
+	})
+	srv.Handle("SELECT broken", &impalatest.Result{Err: errors.New("AnalysisException: table not found")})
+
+	hook := &recordingHook{}
+	db := openServer(t, srv, func(opts *Options) {
+		opts.BatchSize = 2
+		opts.Metrics = hook
+	})
+
+	rows, err := db.Query("SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT broken"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+
+	// connection closes session of first statement when it is reused
+	if hook.opened != 2 || hook.closed != 1 {
+		t.Errorf("sessions opened %d, closed %d, want 2 opened and 1 closed", hook.opened, hook.closed)
+	}
+	if want := map[metrics.Outcome]int{metrics.OutcomeSuccess: 1, metrics.OutcomeError: 1}; !reflect.DeepEqual(hook.outcomes, want) {
+		t.Errorf("outcomes %v, want %v", hook.outcomes, want)
+	}
+	if hook.fetches != 2 || hook.rows != 3 {
+		t.Errorf("%d fetches of %d rows, want 2 fetches of 3 rows", hook.fetches, hook.rows)
+	}
+	if hook.bytes == 0 {
+		t.Error("no bytes received")
+	}
+
+	for _, phase := range []metrics.Phase{metrics.PhaseExecute, metrics.PhaseFirstRow, metrics.PhaseFetch} {
+		if n := len(hook.latencies[phase]); n != 1 {
+			t.Errorf("%d latencies of phase %s, want 1", n, phase)
+		}
+	}
+	execute, firstRow, fetch := hook.latencies[metrics.PhaseExecute], hook.latencies[metrics.PhaseFirstRow], hook.latencies[metrics.PhaseFetch]
+	if len(execute) == 1 && len(firstRow) == 1 && len(fetch) == 1 &&
+		!(10*time.Millisecond <= execute[0] && execute[0] <= firstRow[0] && firstRow[0] <= fetch[0]) {
+		t.Errorf("latencies execute %v, first row %v, fetch %v are not ordered", execute[0], firstRow[0], fetch[0])
+	}
+}
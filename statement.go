@@ -15,7 +15,8 @@ import (
 type Stmt struct {
 	stmt string
 
-	conn *Conn
+	conn         conn
+	interceptors interceptors
 }
 
 // Close statement. No-op
@@ -60,22 +61,14 @@ func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
 
 // QueryContext executes a query that may return rows
 func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	session, err := s.conn.OpenSession(ctx)
-	if err != nil {
-		return nil, err
-	}
 	stmt := statement(s.stmt, args)
-	return query(ctx, session, stmt)
+	return runQuery(ctx, s.conn, s.interceptors, stmt, args)
 }
 
 // ExecContext executes a query that doesn't return rows
 func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	session, err := s.conn.OpenSession(ctx)
-	if err != nil {
-		return nil, err
-	}
 	stmt := statement(s.stmt, args)
-	return exec(ctx, session, stmt)
+	return runExec(ctx, s.conn, s.interceptors, stmt, args)
 }
 
 func template(query string) string {
@@ -115,11 +108,13 @@ func query(ctx context.Context, session *hive.Session, stmt string) (driver.Rows
 
 	schema, err := operation.GetResultSetMetadata(ctx)
 	if err != nil {
+		operation.Close(context.Background())
 		return nil, err
 	}
 
 	rs, err := operation.FetchResults(ctx, schema)
 	if err != nil {
+		operation.Close(context.Background())
 		return nil, err
 	}
 
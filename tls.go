@@ -0,0 +1,20 @@
+package impala
+
+import (
+	"crypto/tls"
+
+	"github.com/bippio/go-impala/tlsconfig"
+)
+
+// tlsConfig builds TLS configuration of options
+func tlsConfig(opts *Options) (*tls.Config, error) {
+	return tlsconfig.New(&tlsconfig.Options{
+		Base:               opts.TLSConfig,
+		CACertPath:         opts.CACertPath,
+		ClientCertPath:     opts.ClientCertPath,
+		ClientKeyPath:      opts.ClientKeyPath,
+		ServerName:         opts.TLSServerName,
+		MinVersion:         opts.TLSMinVersion,
+		InsecureSkipVerify: opts.TLSInsecureSkipVerify,
+	})
+}
@@ -0,0 +1,132 @@
+package impala
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "impala-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certPath, keyPath := writeCert(t, dir)
+
+	t.Run("system roots", func(t *testing.T) {
+		cfg, err := tlsConfig(&Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.RootCAs != nil {
+			t.Error("expected system roots")
+		}
+	})
+
+	t.Run("ca cert", func(t *testing.T) {
+		cfg, err := tlsConfig(&Options{CACertPath: certPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.RootCAs == nil {
+			t.Error("expected custom roots")
+		}
+	})
+
+	t.Run("empty ca cert", func(t *testing.T) {
+		if _, err := tlsConfig(&Options{CACertPath: keyPath}); err == nil {
+			t.Error("expected error for file without certificates")
+		}
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		cfg, err := tlsConfig(&Options{ClientCertPath: certPath, ClientKeyPath: keyPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Certificates) != 1 {
+			t.Errorf("got %d client certificates, want: 1", len(cfg.Certificates))
+		}
+	})
+
+	t.Run("client cert without key", func(t *testing.T) {
+		if _, err := tlsConfig(&Options{ClientCertPath: certPath}); err == nil {
+			t.Error("expected error for missing client key")
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		base := &tls.Config{ServerName: "base", MinVersion: tls.VersionTLS10}
+		cfg, err := tlsConfig(&Options{
+			TLSConfig:             base,
+			TLSServerName:         "impala.local",
+			TLSMinVersion:         "1.2",
+			TLSInsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.ServerName != "impala.local" || cfg.MinVersion != tls.VersionTLS12 || !cfg.InsecureSkipVerify {
+			t.Errorf("unexpected config: server name %s, min version %x, skip verify %v", cfg.ServerName, cfg.MinVersion, cfg.InsecureSkipVerify)
+		}
+		if base.ServerName != "base" {
+			t.Error("base config must not be modified")
+		}
+	})
+
+	t.Run("unknown min version", func(t *testing.T) {
+		if _, err := tlsConfig(&Options{TLSMinVersion: "2.0"}); err == nil {
+			t.Error("expected error for unknown tls version")
+		}
+	})
+}
+
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "impala.local"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"impala.local"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
@@ -0,0 +1,82 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Versions maps names of TLS versions to their values
+var Versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Options for TLS configuration
+type Options struct {
+	// Base is cloned as base TLS configuration
+	Base *tls.Config
+
+	CACertPath     string
+	ClientCertPath string
+	ClientKeyPath  string
+	ServerName     string
+	MinVersion     string
+
+	InsecureSkipVerify bool
+}
+
+// New builds TLS configuration. System roots are used when CA certificate is not provided
+func New(opts *Options) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if opts.Base != nil {
+		cfg = opts.Base.Clone()
+	}
+
+	if opts.CACertPath != "" {
+		caCert, err := ioutil.ReadFile(opts.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACertPath)
+		}
+		cfg.RootCAs = caCertPool
+	}
+
+	if opts.ClientCertPath != "" || opts.ClientKeyPath != "" {
+		if opts.ClientCertPath == "" || opts.ClientKeyPath == "" {
+			return nil, errors.New("Please provide both client certificate and key paths")
+		}
+
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertPath, opts.ClientKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if opts.ServerName != "" {
+		cfg.ServerName = opts.ServerName
+	}
+
+	if opts.MinVersion != "" {
+		v, ok := Versions[opts.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls version %s not recognized", opts.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if opts.InsecureSkipVerify {
+		cfg.InsecureSkipVerify = true
+	}
+
+	return cfg, nil
+}
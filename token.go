@@ -0,0 +1,68 @@
+package impala
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenProvider supplies bearer tokens of JWT authentication. Token is
+// called on every connect and when server rejects the current token, so
+// that expiring tokens are refreshed
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is TokenProvider of fixed token
+type StaticToken string
+
+// Token returns the token
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// FileTokenProvider reads token from file, e.g. service account token
+// mounted by Kubernetes. The file is read again when it changes
+type FileTokenProvider struct {
+	Path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+// NewFileTokenProvider creates provider of token in file at path
+func NewFileTokenProvider(path string) *FileTokenProvider {
+	return &FileTokenProvider{Path: path}
+}
+
+// Token returns content of the file without surrounding whitespace
+func (p *FileTokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// stat follows symlink which kubernetes swaps on update
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("impala: failed to read token: %w", err)
+	}
+	if p.token != "" && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.token, nil
+	}
+
+	b, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("impala: failed to read token: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("impala: token file %s is empty", p.Path)
+	}
+
+	p.token, p.modTime, p.size = token, info.ModTime(), info.Size()
+	return token, nil
+}
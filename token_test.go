@@ -0,0 +1,46 @@
+package impala
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTokenProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	p := NewFileTokenProvider(path)
+	ctx := context.Background()
+
+	if _, err := p.Token(ctx); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	if err := os.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := p.Token(ctx); err != nil || token != "first" {
+		t.Fatalf("got %q, %v", token, err)
+	}
+
+	// kubernetes replaces file by swapping symlink
+	next := path + ".next"
+	if err := os.WriteFile(next, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(next, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := p.Token(ctx); err != nil || token != "second" {
+		t.Fatalf("got %q, %v", token, err)
+	}
+
+	if err := os.WriteFile(path, []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Token(ctx); err == nil {
+		t.Error("expected error for empty token")
+	}
+}